@@ -0,0 +1,165 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// archiveExts are the file extensions of the archives searched for PNG files
+var archiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// containerExts are the file extensions of image formats that are zip files
+// holding PNG files: OpenRaster and Krita documents.
+var containerExts = []string{".ora", ".kra"}
+
+// isArchive reports whether the file is a zip or tar archive or an image
+// container, by its name.
+func isArchive(filename string) bool {
+	return hasExt(filename, archiveExts) || isContainer(filename)
+}
+
+// isContainer reports whether the file is an image container (see
+// containerExts), by its name.
+func isContainer(filename string) bool {
+	return hasExt(filename, containerExts)
+}
+
+// hasExt reports whether filename ends in one of the extensions, in any case.
+func hasExt(filename string, exts []string) bool {
+	lower := strings.ToLower(filename)
+	for _, ext := range exts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// grepArchive searches all PNG files in a zip or (optionally gzipped) tar
+// archive, or in an image container. The results are labeled archive!member,
+// followed by #index with -multi or @offset with -carve. A member that cannot
+// be read is a result with err set, and the other members are still
+// searched. Only if the archive itself cannot be read is an error returned.
+func grepArchive(filename string, rx *regexp.Regexp, opts pngmeta.LoadOptions) ([]result, error) {
+	var results []result
+	members := 0
+	err := archiveMembers(filename, func(member string, r io.Reader, err error) {
+		members++
+		label := filename + "!" + member
+		if err == nil {
+			var found []result
+			found, err = grepMember(filename, label, r, rx, opts)
+			results = append(results, found...)
+		}
+		if err != nil {
+			results = append(results, result{file: filename, label: label, err: err})
+		}
+	})
+	if err != nil && members == 0 {
+		return nil, err
+	}
+	if err != nil {
+		// A broken tar stream ends the search, but keeps the results of the
+		// members before.
+		results = append(results, result{file: filename, label: filename, err: err})
+	}
+	return results, nil
+}
+
+// grepMember searches an archive member like grepFile searches a file.
+func grepMember(filename, label string, r io.Reader, rx *regexp.Regexp, opts pngmeta.LoadOptions) ([]result, error) {
+	switch {
+	case *carve:
+		return carveReader(filename, label, r, rx, opts)
+	case *multi:
+		return grepAll(filename, label, r, rx, opts)
+	}
+	png, err := loadReader(label, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := reportMismatches(label, png); err != nil {
+		return nil, err
+	}
+	return []result{grepPNG(result{file: filename, label: label}, png, rx)}, nil
+}
+
+// archiveMembers calls fn for every PNG file in an archive, in the order they
+// are stored, with the error instead of a reader if a member cannot be
+// opened. Members are recognized as PNG files by their signature or, with
+// -detect=extension, their name (see archiveMember). It returns an error if the archive cannot
+// be read.
+func archiveMembers(filename string, fn func(member string, r io.Reader, err error)) error {
+	lower := strings.ToLower(filename)
+	if strings.HasSuffix(lower, ".zip") || isContainer(filename) {
+		zr, err := zip.OpenReader(filename)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				fn(f.Name, nil, fmt.Errorf("%s!%s: %w", displayName(filename), f.Name, err))
+				continue
+			}
+			archiveMember(f.Name, rc, fn)
+			rc.Close()
+		}
+		return nil
+	}
+	// A .tar.gz is decompressed by openImage.
+	file, err := openImage(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", displayName(filename), err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		archiveMember(hdr.Name, tr, fn)
+	}
+}
+
+// archiveMember calls fn for a member if it is a PNG file. With -carve, every
+// member is, since PNGs may be embedded anywhere in it.
+func archiveMember(member string, r io.Reader, fn func(string, io.Reader, error)) {
+	if *carve {
+		fn(member, r, nil)
+		return
+	}
+	if detect == "extension" {
+		if isPNGName(path.Base(member)) {
+			fn(member, r, nil)
+		}
+		return
+	}
+	br := bufio.NewReader(r)
+	sig, _ := br.Peek(len(pngmeta.PNGMagic))
+	if string(sig) == pngmeta.PNGMagic {
+		fn(member, br, nil)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// A member that cannot be read must not hide the matches in the others.
+func TestGrepArchiveBrokenMember(t *testing.T) {
+	ihdr := []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 2, 0, 0, 0}
+	png, err := pngmeta.NewPNG([]*pngmeta.Chunk{
+		pngmeta.NewChunk("IHDR", ihdr),
+		pngmeta.NewChunk("tEXt", []byte("Comment\x00hello")),
+		pngmeta.NewChunk("IDAT", nil),
+		pngmeta.NewChunk("IEND", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var good bytes.Buffer
+	if _, err := png.WriteTo(&good); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"a.png", good.Bytes()},
+		{"broken.png", good.Bytes()[:20]},
+		{"b.png", good.Bytes()},
+	} {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(m.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := grepArchive(filename, regexp.MustCompile("hello"), searchOptions())
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, want := range []string{"a.png", "broken.png", "b.png"} {
+		res := results[i]
+		if res.label != filename+"!"+want {
+			t.Errorf("result %d: got label %s, want %s", i, res.label, want)
+		}
+		if broken := want == "broken.png"; broken != (res.err != nil) {
+			t.Errorf("%s: got error %v", want, res.err)
+		} else if !broken && !res.found() {
+			t.Errorf("%s: no match", want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"runtime"
+	"time"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// benchTime is the minimum time every input is parsed for by -benchmark
+const benchTime = time.Second
+
+// benchInput is an image parsed repeatedly by -benchmark
+type benchInput struct {
+	name string
+	data []byte
+}
+
+// benchResult holds the totals of parsing one input repeatedly
+type benchResult struct {
+	runs    int
+	bytes   int64
+	elapsed time.Duration
+	allocs  uint64
+}
+
+// runBenchmark parses the files, or if files is nil the images of
+// pngmeta.SyntheticImages, over and over and reports the parse throughput and allocations.
+func runBenchmark(files iter.Seq[string]) int {
+	ret := 0
+	var inputs []benchInput
+	if files == nil {
+		images, err := pngmeta.SyntheticImages()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, img := range images {
+			inputs = append(inputs, benchInput{img.Name, img.Data})
+		}
+	} else {
+		for filename := range files {
+			data, err := readImage(filename)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = 2
+				continue
+			}
+			inputs = append(inputs, benchInput{displayName(filename), data})
+		}
+	}
+	for _, in := range inputs {
+		res, err := benchmarkParse(in.data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", in.name, err)
+			ret = 2
+			continue
+		}
+		perOp := res.elapsed / time.Duration(res.runs)
+		mbs := float64(res.bytes) / 1e6 / res.elapsed.Seconds()
+		fmt.Fprintf(out, "%s: %d runs, %s/op, %d bytes/op, %.1f MB/s, %d allocs/op\n",
+			in.name, res.runs, perOp, len(in.data), mbs,
+			res.allocs/uint64(res.runs))
+		endRecord()
+	}
+	return ret
+}
+
+// benchmarkParse parses data until benchTime has passed, at least once.
+func benchmarkParse(data []byte) (benchResult, error) {
+	var res benchResult
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for res.runs == 0 || time.Since(start) < benchTime {
+		if _, err := pngmeta.LoadWithOptions(bytes.NewReader(data), pngmeta.LoadOptions{}); err != nil {
+			return res, err
+		}
+		res.runs++
+		res.bytes += int64(len(data))
+	}
+	res.elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	res.allocs = after.Mallocs - before.Mallocs
+	return res, nil
+}
+
+// readImage reads all of the named file, opened like any other file searched,
+// so -benchmark can read standard input, URLs and compressed files, too.
+func readImage(filename string) ([]byte, error) {
+	file, err := openImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", displayName(filename), err)
+	}
+	return data, nil
+}
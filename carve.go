@@ -0,0 +1,54 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// carveFile searches every PNG embedded anywhere in the named file, for
+// -carve. The results are labeled file@offset. PNGs that cannot be parsed
+// are reported to stderr, but are not errors, since partial images are to be
+// expected in the kind of data that is carved.
+func carveFile(filename string, rx *regexp.Regexp, opts pngmeta.LoadOptions) ([]result, error) {
+	file, err := openImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return carveReader(filename, filename, file, rx, opts)
+}
+
+// carveReader is carveFile for the data read from r, e.g. an archive member.
+// The results are labeled name@offset.
+func carveReader(filename, name string, r io.Reader, rx *regexp.Regexp, opts pngmeta.LoadOptions) ([]result, error) {
+	opts.Warnings = *warnings
+	opts.Strict, opts.Lenient = *strict, *lenient
+	opts.MaxChunkSize = maxchunk
+	var results []result
+	for c := range pngmeta.Carve(r, opts) {
+		label := fmt.Sprintf("%s@%d", name, c.Offset)
+		for _, w := range c.PNG.Warnings {
+			fmt.Fprintf(os.Stderr, "%s: warning: %s\n", displayName(label), w)
+		}
+		if c.Err != nil && len(c.PNG.Signature) == 0 {
+			return results, fmt.Errorf("%s: %w", displayName(name), c.Err)
+		}
+		if c.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", displayName(label), c.Err)
+			continue
+		}
+		if err := reportMismatches(label, c.PNG); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		results = append(results, grepPNG(result{file: filename, label: label}, c.PNG, rx))
+	}
+	return results, nil
+}
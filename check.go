@@ -0,0 +1,60 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// checkChecksums verifies the chunk checksums of every file and reports the
+// mismatches. It returns 0 if all checksums are fine, 1 if there is at least
+// one mismatch and 2 on errors.
+func checkChecksums(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		mismatches, err := checkOneChecksum(filename)
+		for _, m := range mismatches {
+			fmt.Fprintf(out, "%s: %s\n", displayName(filename), m)
+			if ret == 0 {
+				ret = 1
+			}
+		}
+		endRecord()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+		}
+	}
+	return ret
+}
+
+func checkOneChecksum(filename string) ([]pngmeta.ChecksumMismatch, error) {
+	file, err := openImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mismatches, err := pngmeta.VerifyChecksums(file)
+	if err != nil {
+		return mismatches, fmt.Errorf("%s: %w", displayName(filename), err)
+	}
+	return mismatches, nil
+}
+
+// reportMismatches prints the checksum mismatches found while loading a file
+// for -crc. With -crc-strict, any mismatch is an error.
+func reportMismatches(filename string, png pngmeta.PNG) error {
+	for _, m := range png.ChecksumMismatches {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", displayName(filename), m)
+	}
+	if *crcstrict && len(png.ChecksumMismatches) > 0 {
+		return fmt.Errorf("%s: %d chunks with a wrong CRC32 checksum",
+			displayName(filename), len(png.ChecksumMismatches))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+)
+
+// checksumSummary prints one "hash  filename" line per file, in the format
+// used by sha256sum. The hash only covers the image data, so files that only
+// differ in their metadata chunks produce the same hash.
+func checksumSummary(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		sum, err := checksumOneFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		fmt.Fprintf(out, "%x  %s\n", sum, displayName(filename))
+		endRecord()
+	}
+	return ret
+}
+
+func checksumOneFile(filename string) ([]byte, error) {
+	png, err := loadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return png.ImageDataHash(), nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape sequences for -color, in the colors GNU grep uses by default
+const (
+	colorFilename = "\x1b[35m"
+	colorMatch    = "\x1b[01;31m"
+	colorReset    = "\x1b[m"
+)
+
+// useColor is set if the output is colorized
+var useColor bool
+
+// setupColor decides whether to colorize the output, according to the value
+// of the -color flag. With auto, the output is colorized if it goes to a
+// terminal.
+func setupColor(mode string) error {
+	switch mode {
+	case "always":
+		useColor = true
+	case "never":
+		useColor = false
+	case "auto":
+		useColor = outfile == nil && isTerminal(os.Stdout)
+	default:
+		return fmt.Errorf("invalid -color '%s': must be one of auto, always, never", mode)
+	}
+	return nil
+}
+
+// colorName returns a filename for printing, colorized if enabled.
+func colorName(filename string) string {
+	if !useColor {
+		return filename
+	}
+	return colorFilename + filename + colorReset
+}
+
+// quoteMatch returns a match for printing, quoted and colorized if enabled.
+func quoteMatch(match string) string {
+	if !useColor {
+		return strconv.Quote(match)
+	}
+	return `"` + colorMatch + quoteInner(match) + colorReset + `"`
+}
+
+// highlight returns text quoted like %#v does. If colors are enabled, the
+// parts of the text at locs (as returned by findText) are highlighted.
+func highlight(text string, locs [][]int) string {
+	if !useColor || len(locs) == 0 {
+		return strconv.Quote(text)
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	pos := 0
+	for _, loc := range locs {
+		if loc[0] < pos {
+			continue
+		}
+		sb.WriteString(quoteInner(text[pos:loc[0]]))
+		sb.WriteString(colorMatch)
+		sb.WriteString(quoteInner(text[loc[0]:loc[1]]))
+		sb.WriteString(colorReset)
+		pos = loc[1]
+	}
+	sb.WriteString(quoteInner(text[pos:]))
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// quoteInner quotes s like strconv.Quote, but without the surrounding quotes
+func quoteInner(s string) string {
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// comparison is a numeric filter expression like ">1.5", "<=2" or "16:9". The
+// operator is one of <, <=, >, >=, = and defaults to = if omitted. Values
+// can be given as decimals or as ratios of the form a:b.
+type comparison struct {
+	op    string
+	value float64
+}
+
+func parseComparison(expr string) (comparison, error) {
+	var c comparison
+	s := strings.TrimSpace(expr)
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(s, op) {
+			c.op = op
+			s = strings.TrimSpace(s[len(op):])
+			break
+		}
+	}
+	if c.op == "" {
+		c.op = "="
+	}
+	v, err := parseRatio(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid comparison '%s': %s", expr, err)
+	}
+	c.value = v
+	return c, nil
+}
+
+// parseRatio parses a decimal number or a ratio like "16:9".
+func parseRatio(s string) (float64, error) {
+	num, den, isRatio := strings.Cut(s, ":")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !isRatio {
+		return n, nil
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil {
+		return 0, err
+	}
+	if d == 0 {
+		return 0, fmt.Errorf("zero denominator")
+	}
+	return n / d, nil
+}
+
+// match reports whether v satisfies the comparison. Equality is checked with
+// the given relative tolerance, since ratios rarely come out exact.
+func (c comparison) match(v, tolerance float64) bool {
+	switch c.op {
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	case ">":
+		return v > c.value
+	case ">=":
+		return v >= c.value
+	}
+	return math.Abs(v-c.value) <= tolerance*math.Abs(c.value)
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Signatures of the compression formats images may be wrapped in
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// decompressors are the commands that files compressed with zstd and xz are
+// piped through, like tar and xzgrep do: the standard library has no
+// decoders for these formats.
+var decompressors = []struct {
+	magic []byte
+	cmd   []string
+}{
+	{zstdMagic, []string{"zstd", "-dcq"}},
+	{xzMagic, []string{"xz", "-dcq"}},
+}
+
+// openImage opens the named file like openFile, and decompresses it on the
+// fly if it is compressed with gzip, zstd or xz, as told by its signature.
+// gzip is decompressed by pngrep itself, zstd and xz by the zstd and xz
+// commands, which must be installed for that.
+func openImage(filename string) (io.ReadCloser, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(xzMagic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(io.MultiReader(bytes.NewReader(head), f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", displayName(filename), err)
+		}
+		return readCloser{zr, f}, nil
+	}
+	for _, d := range decompressors {
+		if bytes.HasPrefix(head, d.magic) {
+			r, err := startDecompressor(d.cmd, io.MultiReader(bytes.NewReader(head), f))
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s: %w", displayName(filename), err)
+			}
+			r.f = f
+			return r, nil
+		}
+	}
+	pf := &peekedFile{head, f}
+	if _, ok := f.(io.Seeker); ok {
+		return peekedSeeker{pf}, nil
+	}
+	return pf, nil
+}
+
+// isCompressed reports whether the named file is compressed, as recognized
+// by openImage.
+func isCompressed(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(xzMagic))
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	return bytes.HasPrefix(head, gzipMagic) || bytes.HasPrefix(head, zstdMagic) || bytes.HasPrefix(head, xzMagic)
+}
+
+// cmdReader reads the output of a decompressing command
+type cmdReader struct {
+	io.Reader
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	f      io.Closer
+	done   bool
+}
+
+// startDecompressor starts the command, with the compressed data as its
+// standard input.
+func startDecompressor(args []string, r io.Reader) (*cmdReader, error) {
+	c := &cmdReader{cmd: exec.Command(args[0], args[1:]...)}
+	c.cmd.Stdin = r
+	c.cmd.Stderr = &c.stderr
+	stdout, err := c.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot decompress: %w", err)
+	}
+	c.Reader = stdout
+	return c, nil
+}
+
+// Read reads the decompressed data. Once it is all read, the command must
+// have succeeded, otherwise the data is corrupt.
+func (c *cmdReader) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	if err == io.EOF && !c.done {
+		c.done = true
+		if werr := c.cmd.Wait(); werr != nil {
+			msg := strings.TrimSpace(c.stderr.String())
+			if msg == "" {
+				msg = werr.Error()
+			}
+			return n, fmt.Errorf("%s: %s", c.cmd.Args[0], msg)
+		}
+	}
+	return n, err
+}
+
+// Close stops the command, if the data was not read to the end, and closes
+// the compressed file.
+func (c *cmdReader) Close() error {
+	if !c.done {
+		c.done = true
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	}
+	return c.f.Close()
+}
+
+// readCloser reads from a decompressor and closes the underlying file
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// peekedFile is a file whose first bytes have been read already, to look at
+// its signature.
+type peekedFile struct {
+	head []byte
+	f    io.ReadCloser
+}
+
+func (p *peekedFile) Read(b []byte) (int, error) {
+	if len(p.head) > 0 {
+		n := copy(b, p.head)
+		p.head = p.head[n:]
+		return n, nil
+	}
+	return p.f.Read(b)
+}
+
+func (p *peekedFile) Close() error {
+	return p.f.Close()
+}
+
+// peekedSeeker is a peekedFile that can seek forward, for
+// pngmeta.LoadOptions.SeekImageData.
+type peekedSeeker struct {
+	*peekedFile
+}
+
+func (p peekedSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent || offset < 0 {
+		return 0, fmt.Errorf("peekedSeeker.Seek: only seeking forward is supported")
+	}
+	skip := min(offset, int64(len(p.head)))
+	p.head = p.head[skip:]
+	return p.f.(io.Seeker).Seek(offset-skip, io.SeekCurrent)
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// duplicateKeywords returns the keywords used by more than one text chunk,
+// in the order they first appear, with the number of chunks using them.
+func duplicateKeywords(png pngmeta.PNG) ([]string, map[string]int) {
+	counts := map[string]int{}
+	var dups []string
+	for _, c := range png.Chunks {
+		if !pngmeta.IsTextChunk(c.Type) {
+			continue
+		}
+		k := c.Keyword()
+		if counts[k]++; counts[k] == 2 {
+			dups = append(dups, k)
+		}
+	}
+	return dups, counts
+}
+
+// dedupText removes all but one of the text chunks with the same keyword in
+// the named files, keeping the first or, with keep set to last, the last one.
+// Files without duplicates are left alone, the others are rewritten in
+// place.
+func dedupText(files iter.Seq[string], keep string) int {
+	if keep != "first" && keep != "last" {
+		fmt.Fprintf(os.Stderr, "invalid -dedup '%s': must be first or last\n", keep)
+		return 2
+	}
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		_, counts := duplicateKeywords(png)
+		seen := map[string]int{}
+		n, _ := png.StripChunks(func(c *pngmeta.Chunk) bool {
+			if !pngmeta.IsTextChunk(c.Type) {
+				return false
+			}
+			k := c.Keyword()
+			seen[k]++
+			if keep == "first" {
+				return seen[k] > 1
+			}
+			return seen[k] < counts[k]
+		})
+		if n > 0 {
+			if err := rewriteFile(filename, png); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = 2
+				continue
+			}
+		}
+		fmt.Fprintf(out, "%s: removed %d duplicate text chunks\n", displayName(filename), n)
+		endRecord()
+	}
+	return ret
+}
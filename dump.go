@@ -0,0 +1,91 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"os"
+	"strconv"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// dumpWidth is the number of payload bytes -dump-chunks shows
+const dumpWidth = 16
+
+// dumpChunks lists every chunk of the files with its offset, type, length,
+// checksum status and a short summary of its data, like pngcheck -v does. The
+// chunks read before a parse error are listed, too. It returns 0 if all
+// files could be read, 2 otherwise.
+func dumpChunks(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		name := colorName(displayName(filename))
+		for _, c := range png.Chunks {
+			fmt.Fprintf(out, "%s: %10d  %-4s %10d  %s", name, c.Offset, c.Type, c.Len, crcStatus(c))
+			if summary := chunkSummary(c); summary != "" {
+				fmt.Fprintf(out, "  %s", summary)
+			}
+			fmt.Fprintln(out)
+		}
+		if len(png.Trailing) > 0 {
+			fmt.Fprintf(out, "%s: %d bytes of trailing data after IEND: %s\n",
+				name, len(png.Trailing), hexPrefix(png.Trailing))
+		}
+		endRecord()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+		}
+	}
+	return ret
+}
+
+// crcStatus describes whether the checksum of a chunk is right
+func crcStatus(c *pngmeta.Chunk) string {
+	if c.ValidChecksum() {
+		return "CRC ok"
+	}
+	if len(c.Checksum) != 4 {
+		return "CRC missing"
+	}
+	return fmt.Sprintf("CRC wrong (stored %08x, computed %08x)",
+		binary.BigEndian.Uint32(c.Checksum), c.ComputeChecksum())
+}
+
+// chunkSummary returns a short description of the data of a chunk: the
+// fields of IHDR, the keyword and start of the value of text chunks, and the
+// first bytes in hex for everything else.
+func chunkSummary(c *pngmeta.Chunk) string {
+	switch {
+	case c.DataSkipped:
+		return "(data not loaded)"
+	case c.Type == "IHDR" && len(c.Data) == 13:
+		return fmt.Sprintf("%dx%d, %d bit, %s, interlace %d",
+			binary.BigEndian.Uint32(c.Data[0:4]), binary.BigEndian.Uint32(c.Data[4:8]),
+			c.Data[8], pngmeta.ColorTypeName(int(c.Data[9])), c.Data[12])
+	case pngmeta.IsTextChunk(c.Type):
+		text, err := c.TextValue()
+		if err != nil {
+			return fmt.Sprintf("%q: %s", c.Keyword(), err)
+		}
+		s := strconv.Quote(string(text))
+		if len(text) > 2*dumpWidth {
+			s = strconv.Quote(string(text[:2*dumpWidth])) + "..."
+		}
+		return fmt.Sprintf("%q: %s", c.Keyword(), s)
+	}
+	return hexPrefix(c.Data)
+}
+
+// hexPrefix returns the first dumpWidth bytes of data in hex
+func hexPrefix(data []byte) string {
+	if len(data) > dumpWidth {
+		return fmt.Sprintf("% x ...", data[:dumpWidth])
+	}
+	return fmt.Sprintf("% x", data)
+}
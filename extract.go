@@ -0,0 +1,100 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// extractChunks writes the data of the chunks selected with -extract to
+// separate files, named <filename>.<index>.<type>, next to the image or in the
+// -extract-to directory. Chunks are selected by type or by their index in the
+// file, starting at 0 for IHDR. It returns 0 if at least one chunk was
+// extracted, 1 if none were selected, and 2 on errors.
+func extractChunks(files iter.Seq[string], selectors []string) int {
+	var types []string
+	var indexes []int
+	for _, s := range selectors {
+		if i, err := strconv.Atoi(s); err == nil && i >= 0 {
+			indexes = append(indexes, i)
+			continue
+		}
+		if len(s) != 4 {
+			fmt.Fprintf(os.Stderr, "invalid -extract '%s': must be a chunk type or index\n", s)
+			return 2
+		}
+		types = append(types, s)
+	}
+	ret := 1
+	errors := false
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errors = true
+			continue
+		}
+		for i, c := range png.Chunks {
+			if !slices.Contains(types, c.Type) && !slices.Contains(indexes, i) {
+				continue
+			}
+			outname := extractName(filename, i, c)
+			if err := os.WriteFile(outname, c.Data, 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				errors = true
+				continue
+			}
+			fmt.Fprintf(out, "%s: wrote %s %s (%d bytes)\n",
+				displayName(filename), c.Type, displayName(outname), len(c.Data))
+			endRecord()
+			ret = 0
+		}
+	}
+	if errors {
+		return 2
+	}
+	return ret
+}
+
+// extractName returns the name of the file the i-th chunk of filename is
+// written to by -extract.
+func extractName(filename string, i int, c *pngmeta.Chunk) string {
+	return outputName(filename, fmt.Sprintf(".%d.%s", i, c.Type))
+}
+
+// outputName returns the name of a file the extraction modes write for
+// filename: the filename with the suffix appended, next to the image or in
+// the -extract-to directory. Standard input is named stdin, and a URL by the
+// last element of its path, both in the current directory. The path of an
+// archive member is flattened, so it is written next to the archive.
+func outputName(filename, suffix string) string {
+	switch {
+	case filename == "-":
+		filename = "stdin"
+	case isURL(filename):
+		base := "download"
+		if u, err := url.Parse(filename); err == nil && strings.Trim(u.Path, "/") != "" {
+			base = path.Base(u.Path)
+		}
+		filename = base
+	}
+	if i := strings.LastIndex(filename, "!"); i > 0 && isArchive(filename[:i]) {
+		filename = filename[:i+1] + strings.ReplaceAll(filename[i+1:], "/", "_")
+	}
+	name := filename + suffix
+	if extractto != "" {
+		name = filepath.Join(extractto, filepath.Base(name))
+	}
+	return name
+}
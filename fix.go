@@ -0,0 +1,116 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"os"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// fixChecksums recomputes wrong CRC32 checksums in the named files and
+// rewrites the files with wrong ones in place. Everything else is kept byte
+// for byte. Every fixed chunk is reported. Files with a truncated chunk are
+// left alone, see -repair. It returns 0 if all files could be fixed (or did
+// not need fixing), 2 otherwise.
+func fixChecksums(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		// A truncated chunk has no checksum to fix, and rewriting the file
+		// would lose the data that is there.
+		if err := checkComplete(filename, png); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		name := colorName(displayName(filename))
+		n := 0
+		for _, c := range png.Chunks {
+			if c.ValidChecksum() {
+				continue
+			}
+			stored := c.Checksum
+			c.UpdateChecksum()
+			fmt.Fprintf(out, "%s: %s at offset %d: CRC32 %x replaced by %08x\n",
+				name, c.Type, c.Offset, stored, binary.BigEndian.Uint32(c.Checksum))
+			n++
+		}
+		if n > 0 {
+			if err := rewriteFile(filename, png); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = 2
+				continue
+			}
+		}
+		fmt.Fprintf(out, "%s: fixed %d checksums\n", name, n)
+		endRecord()
+	}
+	return ret
+}
+
+// repairFiles makes the named files structurally valid again, as far as that
+// is possible without guessing: chunks cut off at the end of a truncated file
+// are dropped, an IEND chunk is added after the last complete chunk if there
+// is none, and data after IEND is removed. Every change is reported, and the
+// files that were changed are rewritten in place. It returns 0 if all files
+// could be repaired (or did not need it), 2 otherwise.
+func repairFiles(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		var changes []string
+		for len(png.Chunks) > 1 {
+			c := png.Chunks[len(png.Chunks)-1]
+			if !c.Truncated() {
+				break
+			}
+			changes = append(changes, fmt.Sprintf("removed truncated %s chunk at offset %d", c.Type, c.Offset))
+			png.Chunks = png.Chunks[:len(png.Chunks)-1]
+		}
+		if last := png.Chunks[len(png.Chunks)-1]; last.Type != "IEND" {
+			iend := pngmeta.NewChunk("IEND", nil)
+			iend.Offset = last.Offset + 12 + int64(last.Len)
+			png.Chunks = append(png.Chunks, iend)
+			changes = append(changes, fmt.Sprintf("added IEND chunk at offset %d", iend.Offset))
+		}
+		if len(png.Trailing) > 0 {
+			changes = append(changes, fmt.Sprintf("removed %d bytes after IEND", len(png.Trailing)))
+			png.Trailing = nil
+		}
+		png.NumCHunks = len(png.Chunks)
+		if len(changes) > 0 {
+			if len(png.GetChunksByType("IDAT")) == 0 {
+				fmt.Fprintf(os.Stderr, "%s: no image data left, not repaired\n", displayName(filename))
+				ret = 2
+				continue
+			}
+			if err := rewriteFile(filename, png); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = 2
+				continue
+			}
+		}
+		name := colorName(displayName(filename))
+		for _, c := range changes {
+			fmt.Fprintf(out, "%s: %s\n", name, c)
+		}
+		fmt.Fprintf(out, "%s: made %d changes\n", name, len(changes))
+		endRecord()
+	}
+	return ret
+}
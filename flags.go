@@ -0,0 +1,58 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stringList is a flag.Value that collects the values of a flag that can be
+// given multiple times.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// dateLayouts are the formats accepted by dateFlag, in UTC unless the value
+// has a zone
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// dateFlag is a flag.Value for a point in time, given as a date with an
+// optional time of day. The zero value is unset.
+type dateFlag struct {
+	time.Time
+	set bool
+}
+
+func (d *dateFlag) String() string {
+	if d == nil || !d.set {
+		return ""
+	}
+	return d.Format(time.RFC3339)
+}
+
+func (d *dateFlag) Set(v string) error {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			d.Time, d.set = t, true
+			return nil
+		}
+	}
+	return fmt.Errorf("must be a date like 2022-12-31, optionally with a time like 2022-12-31T23:59:59")
+}
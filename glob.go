@@ -0,0 +1,59 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// globToRegexp translates a shell-style glob pattern into an equivalent,
+// anchored regexp. Supported are `*` (any text), `?` (any single character)
+// and bracket expressions like `[a-z]` and `[!0-9]`.
+func globToRegexp(glob string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			j := i + 1
+			if j < len(glob) && glob[j] == '!' {
+				j++
+			}
+			// A ']' right at the start of the set is part of it.
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			for j < len(glob) && glob[j] != ']' {
+				j++
+			}
+			if j >= len(glob) {
+				return "", fmt.Errorf("unterminated '[' in glob '%s'", glob)
+			}
+			set := glob[i+1 : j]
+			sb.WriteByte('[')
+			if strings.HasPrefix(set, "!") {
+				sb.WriteByte('^')
+				set = set[1:]
+			}
+			sb.WriteString(strings.ReplaceAll(set, `\`, `\\`))
+			sb.WriteByte(']')
+			i = j
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteByte('$')
+	return sb.String(), nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"iter"
+	"os"
+	"strconv"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// hexWildcard stands for any byte in a hexPattern
+const hexWildcard = -1
+
+// hexPattern is a byte sequence searched by -hex, where hexWildcard matches
+// any byte
+type hexPattern []int
+
+// parseHexPattern parses the argument of -hex: pairs of hex digits, or ?? for
+// any byte, optionally separated by whitespace, e.g. "DE AD ?? EF".
+func parseHexPattern(s string) (hexPattern, error) {
+	digits := strings.Join(strings.Fields(s), "")
+	if digits == "" || len(digits)%2 != 0 {
+		return nil, fmt.Errorf("invalid -hex '%s': must be pairs of hex digits or ??", s)
+	}
+	var p hexPattern
+	literal := false
+	for i := 0; i < len(digits); i += 2 {
+		pair := digits[i : i+2]
+		if pair == "??" {
+			p = append(p, hexWildcard)
+			continue
+		}
+		b, err := strconv.ParseUint(pair, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -hex '%s': %q is not a hex byte", s, pair)
+		}
+		p = append(p, int(b))
+		literal = true
+	}
+	if !literal {
+		return nil, fmt.Errorf("invalid -hex '%s': must contain at least one byte that is not ??", s)
+	}
+	return p, nil
+}
+
+// matchAt reports whether p matches data at position i.
+func (p hexPattern) matchAt(data []byte, i int) bool {
+	if i+len(p) > len(data) {
+		return false
+	}
+	for j, b := range p {
+		if b != hexWildcard && data[i+j] != byte(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the positions of all non-overlapping matches of p in data.
+func (p hexPattern) find(data []byte) []int {
+	// Skip ahead to candidates with the first literal byte.
+	first := 0
+	for p[first] == hexWildcard {
+		first++
+	}
+	var found []int
+	for i := 0; i+len(p) <= len(data); {
+		j := bytes.IndexByte(data[i+first:], byte(p[first]))
+		if j < 0 {
+			break
+		}
+		i += j
+		if i+len(p) > len(data) {
+			break
+		}
+		if p.matchAt(data, i) {
+			found = append(found, i)
+			i += len(p)
+			continue
+		}
+		i++
+	}
+	return found
+}
+
+// hexSearch searches the raw data of all chunks of the files, including the
+// compressed image data, and any data after IEND for p. Every match is
+// printed as filename:TYPE[offset]:bytes, with the offset of the match in the
+// file, or trailing[offset] for the data after IEND. With -l, only the names
+// of matching files are printed, and with -c the number of matches per file.
+// It returns the exit code: 0 if anything matched, 1 if nothing did and 2 if
+// there were errors.
+func hexSearch(files iter.Seq[string], p hexPattern) int {
+	ret := 1
+	errs := 0
+	for filename := range files {
+		png, err := loadFileWithOptions(filename, pngmeta.LoadOptions{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errs++
+			if *halt {
+				break
+			}
+			continue
+		}
+		name := colorName(displayName(filename))
+		n := 0
+		report := func(where string, data []byte, start int64) {
+			for _, i := range p.find(data) {
+				n++
+				if !*count && !*fileswith {
+					printFields(name, fmt.Sprintf("%s[%d]", where, start+int64(i)), hex.EncodeToString(data[i:i+len(p)]))
+				}
+			}
+		}
+		var end int64
+		for _, c := range png.Chunks {
+			// The data starts after the length and type.
+			report(c.Type, c.Data, c.Offset+8)
+			end = c.Offset + 12 + int64(len(c.Data))
+		}
+		report("trailing", png.Trailing, end)
+		switch {
+		case *count:
+			printFields(name, n)
+		case *fileswith && n > 0:
+			printFields(name)
+		}
+		if n > 0 {
+			ret = 0
+		}
+		endRecord()
+	}
+	if errs > 0 {
+		ret = 2
+	}
+	return ret
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// seekDiscardLimit is the largest distance httpFile skips by reading instead
+// of making a new range request
+const seekDiscardLimit = 64 << 10
+
+// httpClient downloads remote files. The timeout covers each request
+// including reading its body, so a stalled server can not hang a search (or
+// a -serve request) forever.
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// isURL reports whether a file argument is an HTTP(S) URL
+func isURL(filename string) bool {
+	return strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://")
+}
+
+// httpFile reads a remote file over HTTP. If the server supports range
+// requests, seeking forward skips the data in between by requesting the rest
+// of the file from the new position, so large image data never has to be
+// downloaded. Closing it stops the download.
+type httpFile struct {
+	url    string
+	body   io.ReadCloser
+	pos    int64
+	ranges bool
+}
+
+// openURL starts downloading the file at url
+func openURL(url string) (*httpFile, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return &httpFile{
+		url:    url,
+		body:   resp.Body,
+		ranges: resp.Header.Get("Accept-Ranges") == "bytes",
+	}, nil
+}
+
+func (f *httpFile) Read(p []byte) (int, error) {
+	n, err := f.body.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+// Seek only supports seeking forward.
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	target := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		target += f.pos
+	default:
+		return f.pos, errors.New("httpFile.Seek: unsupported whence")
+	}
+	if target < f.pos {
+		return f.pos, errors.New("httpFile.Seek: cannot seek backwards")
+	}
+	if !f.ranges || target-f.pos <= seekDiscardLimit {
+		n, err := io.CopyN(io.Discard, f.body, target-f.pos)
+		f.pos += n
+		return f.pos, err
+	}
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return f.pos, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", target))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return f.pos, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return f.pos, fmt.Errorf("%s: range request failed: %s", f.url, resp.Status)
+	}
+	f.body.Close()
+	f.body, f.pos = resp.Body, target
+	return f.pos, nil
+}
+
+func (f *httpFile) Close() error {
+	return f.body.Close()
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+)
+
+// extractICCProfiles writes the decompressed ICC profile of every file to
+// <filename>.icc (see outputName). It returns 0 if at least one profile was extracted, 1 if
+// none were found, and 2 on errors.
+func extractICCProfiles(files iter.Seq[string]) int {
+	ret := 1
+	errors := false
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errors = true
+			continue
+		}
+		if len(png.GetChunksByType("iCCP")) == 0 {
+			continue
+		}
+		name, profile, err := png.ICCProfile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", displayName(filename), err)
+			errors = true
+			continue
+		}
+		outname := outputName(filename, ".icc")
+		if err := os.WriteFile(outname, profile, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errors = true
+			continue
+		}
+		printFields(colorName(displayName(filename)), fmt.Sprintf("wrote %q to %s (%d bytes)", name, displayName(outname), len(profile)))
+		endRecord()
+		ret = 0
+	}
+	if errors {
+		return 2
+	}
+	return ret
+}
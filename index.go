@@ -0,0 +1,153 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// indexEntry is the record of one file in an index built by -build-index.
+// The metadata is kept as the parsed PNG, without its image data, so it can
+// be searched with all the options a file can.
+type indexEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	PNG     pngmeta.PNG
+}
+
+// index maps the paths of indexed files to their entries, for -index
+var index map[string]*indexEntry
+
+// buildIndex writes the metadata of the files (and, like with -r, of all the
+// PNG files in the directories) to the index file named indexfile. If the
+// index exists, files whose size and modification time are unchanged are not
+// read again. Archives, which includes image containers like OpenRaster
+// files (see isArchive), are skipped and always searched directly. Like
+// rewriteFile, the index is replaced safely.
+func buildIndex(indexfile string, args []string) int {
+	ret := 0
+	old, _, err := readIndex(indexfile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(indexfile), ".pngrep-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(w)
+	var indexed, updated int
+	errs := 0
+	for filename := range inputFiles(args, &errs) {
+		if isArchive(filename) {
+			// Archives and image containers are searched directly, not
+			// from the index.
+			continue
+		}
+		fi, err := os.Stat(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		e := old[filename]
+		if e == nil || e.Size != fi.Size() || !e.ModTime.Equal(fi.ModTime()) {
+			png, err := loadFileWithOptions(filename, pngmeta.LoadOptions{SkipImageData: true})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				metrics.error()
+				ret = 2
+				continue
+			}
+			metrics.file(&png)
+			// Warnings are not kept, -warnings reads the file again.
+			png.Warnings = nil
+			e = &indexEntry{Path: filename, Size: fi.Size(), ModTime: fi.ModTime(), PNG: png}
+			updated++
+		}
+		if err := enc.Encode(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Writing index failed: %s\n", err)
+			tmp.Close()
+			return 2
+		}
+		indexed++
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing index failed: %s\n", err)
+		tmp.Close()
+		return 2
+	}
+	if err := tmp.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing index failed: %s\n", err)
+		return 2
+	}
+	if err := os.Rename(tmp.Name(), indexfile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Fprintf(out, "%s: indexed %d files, read %d\n", indexfile, indexed, updated)
+	endRecord()
+	if errs > 0 {
+		ret = 2
+	}
+	return ret
+}
+
+// readIndex reads the index file written by buildIndex. It returns the
+// entries by path, and the paths in the order they were indexed.
+func readIndex(indexfile string) (map[string]*indexEntry, []string, error) {
+	f, err := os.Open(indexfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	entries := map[string]*indexEntry{}
+	var paths []string
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	for {
+		var e indexEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading index %s failed: %w", indexfile, err)
+		}
+		entries[e.Path] = &e
+		paths = append(paths, e.Path)
+	}
+	return entries, paths, nil
+}
+
+// indexedPNG returns the metadata of the named file from the index given
+// with -index, if it is there and up to date, i.e. the file's size and
+// modification time are unchanged. Options that need more than the
+// metadata as it was indexed always read the file.
+func indexedPNG(filename string) (pngmeta.PNG, bool) {
+	if index == nil || rawImageData() || *scanidat || *scanlsb || *stealth || *decodechk || *crccheck || *crcstrict || *strict || *lenient || *warnings || *multi {
+		return pngmeta.PNG{}, false
+	}
+	e := index[filename]
+	if e == nil {
+		return pngmeta.PNG{}, false
+	}
+	fi, err := os.Stat(filename)
+	if err != nil || fi.Size() != e.Size || !fi.ModTime().Equal(e.ModTime) {
+		return pngmeta.PNG{}, false
+	}
+	return e.PNG, true
+}
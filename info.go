@@ -0,0 +1,88 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// printInfo prints a short summary of every file, like identify does: the
+// header fields, the number of chunks, the bytes taken up by ancillary chunks,
+// the resolution from the pHYs chunk, any data after IEND, the keywords of
+// the text chunks, with the number of chunks for duplicate ones, and the
+// palette of indexed-color images. Stereoscopic images get a second line with
+// the layout from the sTER chunk. It returns 0 if all files could be read, 2
+// otherwise.
+func printInfo(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		png, err := loadFileWithOptions(filename, pngmeta.LoadOptions{SkipImageData: true})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		interlace := "none"
+		if png.Interlace == 1 {
+			interlace = "Adam7"
+		}
+		meta := 0
+		var keywords []string
+		for _, c := range png.Chunks {
+			// Bit 5 of the first byte is 1 (lowercase) for ancillary chunks.
+			if len(c.Type) == 4 && c.Type[0]&0x20 != 0 {
+				// Length, type and checksum take 12 bytes.
+				meta += c.Len + 12
+			}
+			if pngmeta.IsTextChunk(c.Type) && !slices.Contains(keywords, c.Keyword()) {
+				keywords = append(keywords, c.Keyword())
+			}
+		}
+		fmt.Fprintf(out, "%s: %dx%d, %d bit, %s, interlace %s, %d chunks, %d metadata bytes",
+			colorName(displayName(filename)), png.Width, png.Height, png.Depth,
+			pngmeta.ColorTypeName(png.ColorType), interlace, len(png.Chunks), meta)
+		if p, ok := png.Phys(); ok {
+			if x, y, ok := p.DPI(); ok {
+				fmt.Fprintf(out, ", %.0fx%.0f dpi", x, y)
+			} else {
+				fmt.Fprintf(out, ", pixel aspect %d:%d", p.PixelsPerUnitX, p.PixelsPerUnitY)
+			}
+		}
+		if len(png.Trailing) > 0 {
+			fmt.Fprintf(out, ", %d trailing bytes (%s)", len(png.Trailing), png.TrailingType())
+		}
+		if len(keywords) > 0 {
+			_, counts := duplicateKeywords(png)
+			for i, k := range keywords {
+				if counts[k] > 1 {
+					keywords[i] = fmt.Sprintf("%s (%d times)", k, counts[k])
+				}
+			}
+			fmt.Fprintf(out, ", keywords: %s", strings.Join(keywords, ", "))
+		}
+		if palette, ok := png.Palette(); ok && png.ColorType == 3 {
+			colors := make([]string, len(palette))
+			for i, c := range palette {
+				colors[i] = hexColor(c)
+			}
+			fmt.Fprintf(out, ", palette of %d colors: %s", len(colors), strings.Join(colors, " "))
+		}
+		fmt.Fprintln(out)
+		if mode, ok := png.StereoMode(); ok {
+			layout := "cross-fuse"
+			if mode == pngmeta.StereoDiverging {
+				layout = "diverging-fuse"
+			}
+			fmt.Fprintf(out, "%s: Stereo: %s layout\n", colorName(displayName(filename)), layout)
+		}
+		endRecord()
+	}
+	return ret
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// interactiveMode reports whether -interactive is in effect. It requires both
+// stdin and stderr to be a terminal, and is silently disabled otherwise.
+func interactiveMode() bool {
+	return *interactive && isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// review shows a match on stderr and asks the user what to do about it. The
+// file can be opened in the viewer named by $PNGREP_VIEWER. It returns false
+// if the user wants to quit.
+func review(res result) bool {
+	out.Flush()
+	fmt.Fprintf(os.Stderr, "== %s\n", displayName(res.label))
+	for _, m := range res.chunks {
+		fmt.Fprintf(os.Stderr, "%q\n", m.text)
+	}
+	viewer := os.Getenv("PNGREP_VIEWER")
+	for {
+		if viewer != "" {
+			fmt.Fprint(os.Stderr, "[s]kip / [o]pen / [q]uit? ")
+		} else {
+			fmt.Fprint(os.Stderr, "[s]kip / [q]uit? ")
+		}
+		line, err := stdin.ReadString('\n')
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return false
+		}
+		switch strings.TrimSpace(strings.ToLower(line)) {
+		case "", "s", "skip":
+			return true
+		case "q", "quit":
+			return false
+		case "o", "open":
+			if viewer == "" {
+				fmt.Fprintln(os.Stderr, "Set $PNGREP_VIEWER to open files")
+				continue
+			}
+			cmd := exec.Command(viewer, res.file)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "Running %s failed: %s\n", viewer, err)
+			}
+		}
+	}
+}
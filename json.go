@@ -0,0 +1,159 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// jsonResult is the JSON representation of the matches in one file. With
+// -json, one of these is printed per line (NDJSON).
+type jsonResult struct {
+	Filename  string          `json:"filename"`
+	Image     *jsonImage      `json:"image,omitempty"`
+	NameMatch bool            `json:"name_match,omitempty"`
+	Chunks    []jsonChunk     `json:"chunks,omitempty"`
+	IDAT      []jsonIDATMatch `json:"idat,omitempty"`
+	LSB       []jsonLSBMatch  `json:"lsb,omitempty"`
+	Structure string          `json:"structure,omitempty"`
+	// With -decode-check, whether the image data decodes, and if not, why
+	Decodes     *bool  `json:"decodes,omitempty"`
+	DecodeError string `json:"decode_error,omitempty"`
+}
+
+// jsonImage is the image header (IHDR) information of a file
+type jsonImage struct {
+	Width     int `json:"width"`
+	Height    int `json:"height"`
+	Depth     int `json:"depth"`
+	ColorType int `json:"color_type"`
+	Interlace int `json:"interlace"`
+	// The pHYs chunk, if there is one
+	Phys *jsonPhys `json:"phys,omitempty"`
+}
+
+// jsonPhys is the physical pixel size (pHYs) of an image. The DPI values are
+// only set if the unit is the meter.
+type jsonPhys struct {
+	PixelsPerUnitX uint32  `json:"pixels_per_unit_x"`
+	PixelsPerUnitY uint32  `json:"pixels_per_unit_y"`
+	Unit           string  `json:"unit"`
+	DPIX           float64 `json:"dpi_x,omitempty"`
+	DPIY           float64 `json:"dpi_y,omitempty"`
+}
+
+// jsonChunk is a matching text chunk. The offset is the position of the chunk
+// in the file, and the length that of its data, so the whole chunk takes up
+// length+12 bytes. With -byte-offset, the matches are listed, too.
+type jsonChunk struct {
+	Type    string      `json:"type"`
+	Keyword string      `json:"keyword"`
+	Value   string      `json:"value"`
+	Offset  int64       `json:"offset"`
+	Length  int         `json:"length"`
+	Matches []jsonMatch `json:"matches,omitempty"`
+}
+
+// jsonMatch is a match within a chunk, see matchLocations. The offset is the
+// position of the match in the file, if it has one.
+type jsonMatch struct {
+	Where  string `json:"where"`
+	Offset *int64 `json:"offset,omitempty"`
+	Match  string `json:"match"`
+}
+
+type jsonIDATMatch struct {
+	Offset int    `json:"offset"`
+	Match  string `json:"match"`
+}
+
+// jsonLSBMatch is a match in text hidden in the pixels, see scanLSB
+type jsonLSBMatch struct {
+	Plane  string `json:"plane"`
+	Offset int    `json:"offset"`
+	Match  string `json:"match"`
+}
+
+// jsonSummary is printed as the last line with -json-stream.
+type jsonSummary struct {
+	Summary stats `json:"_summary"`
+}
+
+func printJSON(res result, rx *regexp.Regexp) {
+	writeJSON(jsonRecord(res, rx))
+}
+
+// jsonRecord returns the JSON representation of a result
+func jsonRecord(res result, rx *regexp.Regexp) jsonResult {
+	jr := jsonResult{
+		Filename:  displayName(res.label),
+		NameMatch: res.name,
+		Structure: res.structure,
+	}
+	if res.png != nil {
+		jr.Image = &jsonImage{
+			Width:     res.png.Width,
+			Height:    res.png.Height,
+			Depth:     res.png.Depth,
+			ColorType: res.png.ColorType,
+			Interlace: res.png.Interlace,
+		}
+		if p, ok := res.png.Phys(); ok {
+			jp := &jsonPhys{PixelsPerUnitX: p.PixelsPerUnitX, PixelsPerUnitY: p.PixelsPerUnitY, Unit: "unknown"}
+			if x, y, ok := p.DPI(); ok {
+				jp.Unit, jp.DPIX, jp.DPIY = "meter", x, y
+			}
+			jr.Image.Phys = jp
+		}
+	}
+	for _, m := range res.chunks {
+		keyword, value, _ := strings.Cut(m.text, "\x00")
+		jc := jsonChunk{Type: m.chunk.Type, Keyword: keyword, Value: value, Offset: m.chunk.Offset, Length: m.chunk.Len}
+		if *byteoffset {
+			for _, ml := range matchLocations(m, rx) {
+				jm := jsonMatch{Where: ml.where, Match: ml.match}
+				if ml.offset >= 0 {
+					jm.Offset = &ml.offset
+				}
+				jc.Matches = append(jc.Matches, jm)
+			}
+		}
+		jr.Chunks = append(jr.Chunks, jc)
+	}
+	for _, m := range res.idat {
+		jr.IDAT = append(jr.IDAT, jsonIDATMatch{m.offset, string(m.text)})
+	}
+	for _, m := range res.lsb {
+		jr.LSB = append(jr.LSB, jsonLSBMatch{m.plane, m.offset, string(m.text)})
+	}
+	if *decodechk && res.searched {
+		decodes := res.decodeErr == nil
+		jr.Decodes = &decodes
+		if res.decodeErr != nil {
+			jr.DecodeError = res.decodeErr.Error()
+		}
+	}
+	return jr
+}
+
+// writeJSON prints v as a single line. With -json-stream, the output is
+// flushed right away, so consumers see every object as soon as it is
+// complete.
+func writeJSON(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Encoding JSON failed: %s\n", err)
+		return
+	}
+	out.Write(b)
+	out.WriteByte('\n')
+	if *jsonstream {
+		out.Flush()
+	}
+	endRecord()
+}
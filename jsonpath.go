@@ -0,0 +1,134 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pathStep is one step of a -jsonpath selector: an object member or array
+// element by name or index, or all of them.
+type pathStep struct {
+	name     string
+	wildcard bool
+}
+
+// jsonPath is the parsed -jsonpath selector, nil if there is none
+var jsonPath []pathStep
+
+// parseJSONPath parses a simple JSONPath selector like $.a.b[0]['c d'].* The
+// leading $ is optional, so gjson-style paths like a.b.0 work, too. Array
+// elements can be selected by [n] or .n, and * selects all members or
+// elements.
+func parseJSONPath(path string) ([]pathStep, error) {
+	p := strings.TrimPrefix(path, "$")
+	var steps []pathStep
+	first := true
+	for p != "" {
+		switch {
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid -jsonpath '%s': missing ]", path)
+			}
+			sel := p[1:end]
+			p = p[end+1:]
+			switch {
+			case sel == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				steps = append(steps, pathStep{name: sel[1 : len(sel)-1]})
+			default:
+				if _, err := strconv.Atoi(sel); err != nil {
+					return nil, fmt.Errorf("invalid -jsonpath '%s': [%s] must be an index, a quoted name or *", path, sel)
+				}
+				steps = append(steps, pathStep{name: sel})
+			}
+		case p[0] == '.' || first:
+			p = strings.TrimPrefix(p, ".")
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			name := p[:end]
+			p = p[end:]
+			if name == "" {
+				return nil, fmt.Errorf("invalid -jsonpath '%s': empty name", path)
+			}
+			steps = append(steps, pathStep{name: name, wildcard: name == "*"})
+		default:
+			return nil, fmt.Errorf("invalid -jsonpath '%s': unexpected '%c'", path, p[0])
+		}
+		first = false
+	}
+	return steps, nil
+}
+
+// selectJSON returns the values in v selected by the path steps
+func selectJSON(v any, steps []pathStep) []any {
+	if len(steps) == 0 {
+		return []any{v}
+	}
+	step, rest := steps[0], steps[1:]
+	var selected []any
+	switch v := v.(type) {
+	case map[string]any:
+		if step.wildcard {
+			for _, k := range sortedKeys(v) {
+				selected = append(selected, selectJSON(v[k], rest)...)
+			}
+		} else if m, ok := v[step.name]; ok {
+			selected = selectJSON(m, rest)
+		}
+	case []any:
+		if step.wildcard {
+			for _, e := range v {
+				selected = append(selected, selectJSON(e, rest)...)
+			}
+		} else if i, err := strconv.Atoi(step.name); err == nil && i >= 0 && i < len(v) {
+			selected = selectJSON(v[i], rest)
+		}
+	}
+	return selected
+}
+
+// sortedKeys returns the keys of m in order, for a stable output
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// jsonPathValues returns the values the -jsonpath selector selects in a JSON
+// text: strings as they are, everything else as compact JSON. ok is false if
+// the text is not JSON.
+func jsonPathValues(text []byte) ([]string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	var values []string
+	for _, s := range selectJSON(v, jsonPath) {
+		if str, ok := s.(string); ok {
+			values = append(values, str)
+			continue
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			continue
+		}
+		values = append(values, string(b))
+	}
+	return values, true
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// largeText is a text chunk whose decoded value exceeds the size threshold
+type largeText struct {
+	filename string
+	chunk    string
+	keyword  string
+	size     int
+}
+
+// reportLargeText prints all text chunks with a decoded value larger than
+// threshold bytes, largest first. With -sort=size, the list is sorted across
+// all files, otherwise within every file.
+func reportLargeText(files iter.Seq[string], threshold int) int {
+	ret := 0
+	var all []largeText
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		var found []largeText
+		for _, c := range png.Chunks {
+			if !pngmeta.IsTextChunk(c.Type) {
+				continue
+			}
+			value, err := c.TextValue()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s %s: %s\n", displayName(filename), c.Type, c.Keyword(), err)
+				ret = 2
+				continue
+			}
+			if len(value) > threshold {
+				found = append(found, largeText{filename, c.Type, c.Keyword(), len(value)})
+			}
+		}
+		if sortby == "size" {
+			all = append(all, found...)
+			continue
+		}
+		printLargeText(found)
+	}
+	printLargeText(all)
+	return ret
+}
+
+func printLargeText(lt []largeText) {
+	slices.SortStableFunc(lt, func(a, b largeText) int {
+		return cmp.Compare(b.size, a.size)
+	})
+	for _, t := range lt {
+		printFields(displayName(t.filename), t.chunk, t.keyword, t.size)
+		endRecord()
+	}
+}
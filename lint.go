@@ -0,0 +1,308 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// largeTextThreshold is the size of a tEXt value above which lint suggests
+// compressing it into a zTXt chunk.
+const largeTextThreshold = 1024
+
+// Severities of lint findings: errors violate the PNG specification,
+// warnings are valid, but not optimal.
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// lintFinding is a single issue found by a lint check
+type lintFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// lintChecks are run in order by -lint. Each returns a message for every
+// issue it finds.
+var lintChecks = []struct {
+	name     string
+	severity string
+	fn       func(pngmeta.PNG) []string
+}{
+	{"chunk-order", lintError, lintChunkOrder},
+	{"consecutive-idat", lintError, lintConsecutiveIDAT},
+	{"palette", lintError, lintPalette},
+	{"multiple-chunks", lintError, lintMultipleChunks},
+	{"critical-chunks", lintError, lintCriticalChunks},
+	{"chunk-after-iend", lintError, lintChunkAfterIEND},
+	{"keyword", lintError, lintKeywords},
+	{"split-idat", lintWarning, lintSplitIDAT},
+	{"duplicate-text", lintWarning, lintDuplicateText},
+	{"duplicate-keyword", lintWarning, lintDuplicateKeywords},
+	{"uncompressed-text", lintWarning, lintUncompressedText},
+	{"redundant-gama", lintWarning, lintRedundantGamma},
+	{"srgb-iccp", lintWarning, lintSRGBAndICCP},
+	{"trailing-data", lintWarning, lintTrailingData},
+}
+
+// jsonLint is the JSON representation of the findings in one file, printed
+// by -lint -json
+type jsonLint struct {
+	Filename string        `json:"filename"`
+	Findings []lintFinding `json:"findings"`
+}
+
+// lintFiles reports violations of the specification and structures that are
+// valid, but not optimal, as filename, severity, check and message, or with
+// -json as one object per file. It returns 0 if no issues were found, 1 if
+// there was at least one, and 2 on errors.
+func lintFiles(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		findings := lintPNG(png)
+		if len(findings) > 0 && ret == 0 {
+			ret = 1
+		}
+		if *jsonout {
+			if len(findings) > 0 {
+				writeJSON(jsonLint{displayName(filename), findings})
+			}
+			continue
+		}
+		for _, f := range findings {
+			printFields(colorName(displayName(filename)), f.Severity, f.Check, f.Message)
+		}
+		endRecord()
+	}
+	return ret
+}
+
+func lintPNG(png pngmeta.PNG) []lintFinding {
+	var findings []lintFinding
+	for _, lc := range lintChecks {
+		for _, msg := range lc.fn(png) {
+			findings = append(findings, lintFinding{lc.name, lc.severity, msg})
+		}
+	}
+	return findings
+}
+
+// chunkPlacement are the ancillary chunks whose position the specification
+// restricts: they must come before the PLTE chunk, or after it, and before
+// the image data.
+var chunkPlacement = map[string]struct{ beforePLTE, afterPLTE bool }{
+	"cHRM": {beforePLTE: true},
+	"gAMA": {beforePLTE: true},
+	"iCCP": {beforePLTE: true},
+	"sBIT": {beforePLTE: true},
+	"sRGB": {beforePLTE: true},
+	"cICP": {beforePLTE: true},
+	"mDCv": {beforePLTE: true},
+	"cLLi": {beforePLTE: true},
+	"bKGD": {afterPLTE: true},
+	"hIST": {afterPLTE: true},
+	"tRNS": {afterPLTE: true},
+	"pHYs": {},
+	"sPLT": {},
+	"oFFs": {},
+	"acTL": {},
+}
+
+// singleChunks are the chunk types that may only appear once
+var singleChunks = []string{"IHDR", "PLTE", "IEND", "cHRM", "gAMA", "iCCP",
+	"sBIT", "sRGB", "cICP", "mDCv", "cLLi", "bKGD", "hIST", "tRNS", "pHYs",
+	"tIME", "eXIf", "oFFs", "acTL", "sTER"}
+
+func lintChunkOrder(png pngmeta.PNG) []string {
+	var msgs []string
+	var sawPLTE, sawIDAT bool
+	hasPLTE := len(png.GetChunksByType("PLTE")) > 0
+	for i, c := range png.Chunks {
+		switch c.Type {
+		case "IHDR":
+			if i != 0 {
+				msgs = append(msgs, fmt.Sprintf("IHDR at offset %d is not the first chunk", c.Offset))
+			}
+		case "PLTE":
+			if sawIDAT {
+				msgs = append(msgs, fmt.Sprintf("PLTE at offset %d comes after the image data", c.Offset))
+			}
+			sawPLTE = true
+		case "IDAT":
+			sawIDAT = true
+		}
+		p, ok := chunkPlacement[c.Type]
+		switch {
+		case !ok:
+		case sawIDAT:
+			msgs = append(msgs, fmt.Sprintf("%s at offset %d must come before the image data", c.Type, c.Offset))
+		case p.beforePLTE && sawPLTE:
+			msgs = append(msgs, fmt.Sprintf("%s at offset %d must come before PLTE", c.Type, c.Offset))
+		case p.afterPLTE && hasPLTE && !sawPLTE:
+			msgs = append(msgs, fmt.Sprintf("%s at offset %d must come after PLTE", c.Type, c.Offset))
+		}
+	}
+	if len(png.Chunks) > 0 && png.Chunks[0].Type != "IHDR" {
+		msgs = append(msgs, fmt.Sprintf("the first chunk is %s, not IHDR", png.Chunks[0].Type))
+	}
+	return msgs
+}
+
+func lintConsecutiveIDAT(png pngmeta.PNG) []string {
+	var sawIDAT, idatDone bool
+	for _, c := range png.Chunks {
+		if c.Type == "IDAT" {
+			if idatDone {
+				return []string{fmt.Sprintf("IDAT at offset %d is separated from the IDAT chunks before it", c.Offset)}
+			}
+			sawIDAT = true
+		} else if sawIDAT {
+			idatDone = true
+		}
+	}
+	return nil
+}
+
+func lintPalette(png pngmeta.PNG) []string {
+	n := len(png.GetChunksByType("PLTE"))
+	switch {
+	case n > 0 && (png.ColorType == 0 || png.ColorType == 4):
+		return []string{fmt.Sprintf("PLTE chunk is not allowed for color type %d (%s)", png.ColorType, pngmeta.ColorTypeName(png.ColorType))}
+	case n == 0 && png.ColorType == 3:
+		return []string{"indexed-color image without a PLTE chunk"}
+	}
+	return nil
+}
+
+func lintMultipleChunks(png pngmeta.PNG) []string {
+	var msgs []string
+	for _, t := range singleChunks {
+		if n := len(png.GetChunksByType(t)); n > 1 {
+			msgs = append(msgs, fmt.Sprintf("%d %s chunks, only one is allowed", n, t))
+		}
+	}
+	return msgs
+}
+
+func lintCriticalChunks(png pngmeta.PNG) []string {
+	var msgs []string
+	for _, c := range png.Chunks {
+		// Bit 5 of the first byte is 0 (uppercase) for critical chunks.
+		if len(c.Type) == 4 && c.Type[0]&0x20 == 0 && !slices.Contains([]string{"IHDR", "PLTE", "IDAT", "IEND"}, c.Type) {
+			msgs = append(msgs, fmt.Sprintf("unknown critical chunk %s at offset %d", c.Type, c.Offset))
+		}
+	}
+	if len(png.GetChunksByType("IDAT")) == 0 {
+		msgs = append(msgs, "no IDAT chunk")
+	}
+	if len(png.GetChunksByType("IEND")) == 0 {
+		msgs = append(msgs, "no IEND chunk")
+	}
+	return msgs
+}
+
+func lintChunkAfterIEND(png pngmeta.PNG) []string {
+	// What follows IEND looks like a chunk if it has a length and a type of
+	// four letters.
+	t := png.Trailing
+	if len(t) < 12 {
+		return nil
+	}
+	for _, b := range t[4:8] {
+		if !('A' <= b && b <= 'Z' || 'a' <= b && b <= 'z') {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("%s chunk after IEND", t[4:8])}
+}
+
+func lintKeywords(png pngmeta.PNG) []string {
+	var msgs []string
+	for _, c := range png.Chunks {
+		if !pngmeta.IsTextChunk(c.Type) {
+			continue
+		}
+		if err := pngmeta.ValidKeyword(c.Keyword()); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s at offset %d: %s", c.Type, c.Offset, err))
+		}
+	}
+	return msgs
+}
+
+func lintSRGBAndICCP(png pngmeta.PNG) []string {
+	if len(png.GetChunksByType("sRGB")) > 0 && len(png.GetChunksByType("iCCP")) > 0 {
+		return []string{"both sRGB and iCCP chunks are present, only one should be"}
+	}
+	return nil
+}
+
+func lintSplitIDAT(png pngmeta.PNG) []string {
+	if n := len(png.GetChunksByType("IDAT")); n > 1 {
+		return []string{fmt.Sprintf("image data is split into %d IDAT chunks, which could be merged into one", n)}
+	}
+	return nil
+}
+
+func lintDuplicateText(png pngmeta.PNG) []string {
+	var msgs []string
+	seen := make(map[string]bool)
+	for _, c := range png.Chunks {
+		if !pngmeta.IsTextChunk(c.Type) {
+			continue
+		}
+		key := c.Type + "\x00" + string(c.Data)
+		if seen[key] {
+			msgs = append(msgs, fmt.Sprintf("%s chunk with keyword %q is an exact duplicate of an earlier one", c.Type, c.Keyword()))
+		}
+		seen[key] = true
+	}
+	return msgs
+}
+
+func lintDuplicateKeywords(png pngmeta.PNG) []string {
+	var msgs []string
+	dups, counts := duplicateKeywords(png)
+	for _, k := range dups {
+		msgs = append(msgs, fmt.Sprintf("%d text chunks with keyword %q, consumers may use any of them", counts[k], k))
+	}
+	return msgs
+}
+
+func lintUncompressedText(png pngmeta.PNG) []string {
+	var msgs []string
+	for _, c := range png.GetChunksByType("tEXt") {
+		value, err := c.TextValue()
+		if err == nil && len(value) > largeTextThreshold {
+			msgs = append(msgs, fmt.Sprintf("tEXt chunk with keyword %q has %d bytes of text, which could be compressed as zTXt", c.Keyword(), len(value)))
+		}
+	}
+	return msgs
+}
+
+func lintRedundantGamma(png pngmeta.PNG) []string {
+	if len(png.GetChunksByType("sRGB")) > 0 && len(png.GetChunksByType("gAMA")) > 0 {
+		return []string{"gAMA chunk is redundant, since sRGB is present"}
+	}
+	return nil
+}
+
+func lintTrailingData(png pngmeta.PNG) []string {
+	if len(png.Trailing) > 0 {
+		return []string{fmt.Sprintf("%d bytes of data after IEND (%s)", len(png.Trailing), png.TrailingType())}
+	}
+	return nil
+}
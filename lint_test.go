@@ -0,0 +1,64 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+func TestLintChunkOrder(t *testing.T) {
+	// 1x1, 8 bit indexed-color
+	ihdr := []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 3, 0, 0, 0}
+	for _, tc := range []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{"valid", []string{"IHDR", "gAMA", "PLTE", "tRNS", "IDAT", "IEND"}, nil},
+		{"tRNS before PLTE", []string{"IHDR", "tRNS", "PLTE", "IDAT", "IEND"},
+			[]string{"tRNS at offset 33 must come after PLTE"}},
+		{"gAMA after PLTE", []string{"IHDR", "PLTE", "gAMA", "IDAT", "IEND"},
+			[]string{"gAMA at offset 48 must come before PLTE"}},
+		{"bKGD after IDAT", []string{"IHDR", "PLTE", "IDAT", "bKGD", "IEND"},
+			[]string{"bKGD at offset 60 must come before the image data"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var chunks []*pngmeta.Chunk
+			for _, typ := range tc.order {
+				var data []byte
+				switch typ {
+				case "IHDR":
+					data = ihdr
+				case "PLTE":
+					data = []byte{0, 0, 0}
+				case "tRNS", "bKGD":
+					data = []byte{0}
+				case "gAMA":
+					data = []byte{0, 0, 0xb1, 0x8f}
+				}
+				chunks = append(chunks, pngmeta.NewChunk(typ, data))
+			}
+			// Write and load the image, for the offsets of the chunks
+			img, err := pngmeta.NewPNG(chunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if _, err := img.WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+			png, err := pngmeta.Load(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lintChunkOrder(png); !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -9,82 +9,964 @@
 package main
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+var (
+	reqchunks    stringList
+	reqkeywords  stringList
+	outname      string
+	pathmode     string
+	sortby       string
+	largetext    int
+	globpat      bool
+	fixedpat     bool
+	print0       bool
+	filesfrom    string
+	nulsep       bool
+	includes     stringList
+	excludes     stringList
+	excludedirs  stringList
+	detect       string
+	settext      stringList
+	stripalso    stringList
+	stripto      string
+	dedup        string
+	replacement  string
+	redactwith   string
+	redactwhole  bool
+	extract      stringList
+	extractto    string
+	sample       int
+	seed         uint64
+	aspect       string
+	aspecttol    float64
+	aspectcmp    *comparison
+	hascolor     string
+	colortol     int
+	colorwant    *colorFilter
+	modafter     dateFlag
+	modbefore    dateFlag
+	mindpi       float64
+	sdseed       string
+	sdmodelhash  string
+	fieldsep     string
+	keyfilter    string
+	xmpfield     string
+	jsonpath     string
+	chunktype    string
+	hexsearch    string
+	workers      int
+	maxchunk     int
+	indexout     string
+	indexfile    string
+	serveaddr    string
+	serveroot    string
+	serveurls    bool
+	servemaxsize int64
+	metricsaddr  string
+	watchevery   time.Duration
+	colormode    string
+	patterns     stringList
+	patternfile  string
 )
 
 var (
-	caseins   = flag.Bool("i", false, "Make regexp case-insensitive")
-	showmatch = flag.Bool("w", false, "Show matching text chunks")
+	caseins      = flag.Bool("i", false, "Make regexp case-insensitive")
+	showmatch    = flag.Bool("w", false, "Show matching text chunks")
+	hexdump      = flag.Bool("hexdump", false, "Like -w, but show the matching text chunks as a hex and ASCII dump")
+	fileswith    = flag.Bool("l", false, "Only print the names of files with matches")
+	fileswithout = flag.Bool("L", false, "Only print the names of files without any match")
+	quiet        = flag.Bool("q", false, "Print nothing, exit with status 0 as soon as anything matches")
+	invert       = flag.Bool("v", false, "Select text chunks that do not match, and files in which no text chunk matches")
+	count        = flag.Bool("c", false, "Only print the number of matching chunks per file")
+	matchratio   = flag.Bool("match-ratio", false, "Only print the fraction of text chunks matching per file")
+	perchunk     = flag.Bool("per-chunk", false, "With -c, count every match within the chunks instead of matching chunks")
+	strip        = flag.Bool("strip", false, "Remove all text chunks from the files, rewriting them in place")
+	checksum     = flag.Bool("checksum-summary", false, "Print SHA-256 hashes of the image data instead of searching")
+	warnings     = flag.Bool("warnings", false, "Print non-fatal parse warnings to stderr")
+	checkcomp    = flag.Bool("check-text-compression", false, "Report zTXt/iTXt chunks whose compressed text cannot be decompressed")
+	matchname    = flag.Bool("name", false, "Match the regexp against the filename instead of the text chunks")
+	contents     = flag.Bool("contents", false, "With -name, also match against the text chunks")
+	onlymatching = flag.Bool("o", false, "Print only the matching parts of the text chunks, one per line")
+	byteoffset   = flag.Bool("byte-offset", false, "Print every match with its offset")
+	showtype     = flag.Bool("show-type", false, "Show whether the filename (name) or a chunk (its type) matched")
+	linebuf      = flag.Bool("line-buffered", false, "Flush output after every match")
+	jsonout      = flag.Bool("json", false, "Print one JSON object per matching file (NDJSON)")
+	jsonstream   = flag.Bool("json-stream", false, "Like -json, but flush every object and finish with a summary object")
+	matchstruct  = flag.Bool("match-structure", false, "Match against the sequence of chunk types (e.g. IHDRtEXtIDATIEND) instead of the text chunks")
+	keyonly      = flag.Bool("keyword", false, "Match the regexp against the keywords of text chunks only")
+	valueonly    = flag.Bool("value", false, "Match the regexp against the values of text chunks only")
+	rawtext      = flag.Bool("raw-text", false, "Match against the raw chunk data, including the keyword/value NUL separator")
+	normspace    = flag.Bool("normalize-space", false, "Collapse runs of whitespace to one space and trim keyword and value before matching")
+	exifsearch   = flag.Bool("exif", false, "Also match against the decoded fields of the eXIf chunk (e.g. Make, Model, DateTime, GPSPosition)")
+	sdsearch     = flag.Bool("sd", false, "Match against the fields of Stable Diffusion parameters (Prompt, Seed, Sampler, ...) instead of the raw text")
+	comfysearch  = flag.Bool("comfy", false, "Match against the nodes of ComfyUI prompts and workflows (class_type, Class.input) instead of the raw JSON")
+	xmpsearch    = flag.Bool("xmp", false, "Match against the properties of the XMP packet (e.g. dc:creator) instead of its raw XML")
+	scanidat     = flag.Bool("scan-idat", false, "Also match against the decompressed image data (slow)")
+	stealth      = flag.Bool("stealth", false, "Also search metadata hidden in the pixels with NovelAI's stealth scheme (slow)")
+	scanlsb      = flag.Bool("scan-lsb", false, "Also match against printable text hidden in the least significant bits of the pixels (slow)")
+	stereo       = flag.Bool("stereo", false, "Only consider stereoscopic images (with an sTER chunk)")
+	trailing     = flag.Bool("trailing", false, "Only consider images with data after the IEND chunk")
+
+	recursive   = flag.Bool("r", false, "Search all PNG files in directories given, recursively")
+	archives    = flag.Bool("archive", false, "With -r, also search the PNG files in zip and tar archives")
+	multi       = flag.Bool("multi", false, "Search all PNGs concatenated in a file, reporting them as file#index")
+	carve       = flag.Bool("carve", false, "Search all PNGs embedded anywhere in a file, e.g. a memory dump, reporting them as file@offset")
+	watch       = flag.Bool("watch", false, "Keep watching the directories given, searching files as they are created or modified")
+	interactive = flag.Bool("interactive", false, "Ask what to do after every match (requires a terminal)")
+
+	lint      = flag.Bool("lint", false, "Report valid but non-optimal structures, like split IDAT or duplicate text chunks")
+	benchmark = flag.Bool("benchmark", false, "Parse the files (or synthetic images) repeatedly and report throughput and allocations")
+	fixcrc    = flag.Bool("fix-crc", false, "Recompute wrong CRC32 checksums, rewriting the files in place")
+	repair    = flag.Bool("repair", false, "Drop truncated chunks, add a missing IEND and remove data after IEND, rewriting the files in place")
+	check     = flag.Bool("check", false, "Verify the CRC32 checksums of all chunks, without keeping chunk data in memory")
+	crccheck  = flag.Bool("crc", false, "While searching, report chunks with a wrong CRC32 checksum to stderr")
+	decodechk = flag.Bool("decode-check", false, "While searching, also decode the image data and report images that do not decode as errors")
+	crcstrict = flag.Bool("crc-strict", false, "Like -crc, but treat files with a wrong checksum as errors instead of searching them")
+	redact    = flag.Bool("redact", false, "Replace the matches (or with -secrets or -privacy-audit, the findings) in text chunk values with a placeholder, rewriting the files in place")
+	privacy   = flag.Bool("privacy-audit", false, "Report personally identifying metadata like GPS positions, serial numbers, authors and email addresses")
+	polyglot  = flag.Bool("polyglot", false, "Report images that are also archives or executables, or contain HTML or script markers, e.g. to bypass upload filters")
+	secrets   = flag.Bool("secrets", false, "Scan text chunks for credentials like AWS keys, private keys and API tokens")
+	dump      = flag.Bool("dump-chunks", false, "List every chunk with its offset, length, CRC status and a summary of its data")
+	info      = flag.Bool("info", false, "Print the size, bit depth, color type, chunk count and text keywords of every file")
+	iccout    = flag.Bool("extract-icc", false, "Write the decompressed ICC profile (iCCP) of every file to <file>.icc")
+	thumbnail = flag.Bool("extract-thumbnail", false, "Write the EXIF thumbnail of every file to <file>.thumb.jpg")
+
+	strict  = flag.Bool("strict", false, "Treat files violating the PNG specification (checksums, chunk order, keywords) as errors")
+	lenient = flag.Bool("lenient", false, "Salvage what can be read from malformed files instead of failing")
+	halt    = flag.Bool("halt-on-error", false, "Stop at the first file that cannot be read or parsed")
+	summary = flag.Bool("summary", false, "Print the number of files, matches and errors to stderr at the end")
+	timing  = flag.Bool("timing", false, "Print the time spent on every file to stderr")
 )
 
 func main() {
 	ret := 1
+	flag.Var(&reqchunks, "require-chunk", "Report files lacking a chunk of this type (repeatable)")
+	flag.Var(&stripalso, "strip-also", "With -strip, also remove chunks of this type, e.g. eXIf or tIME (repeatable)")
+	flag.StringVar(&stripto, "strip-to", "", "With -strip, write the stripped files to this directory instead of rewriting them")
+	flag.StringVar(&replacement, "replace", "", "Replace the matches in text chunk values with this template ($1 for capture groups), rewriting the files in place")
+	flag.Var(&extract, "extract", "Write the data of chunks of this type, or with this index, to <file>.<index>.<type> (repeatable)")
+	flag.StringVar(&extractto, "extract-to", "", "With -extract, -extract-icc or -extract-thumbnail, write the files to this directory instead of next to the images")
+	flag.StringVar(&redactwith, "redact-with", "[REDACTED]", "With -redact, the placeholder to replace matches with")
+	flag.BoolVar(&redactwhole, "redact-whole", false, "With -redact, replace the whole value of matching text chunks instead of only the matches")
+	flag.StringVar(&dedup, "dedup", "", "Remove all but the first or last text chunk with the same keyword, rewriting the files in place")
+	flag.Var(&settext, "set", "Set a text chunk, given as keyword=value, rewriting the files in place (repeatable)")
+	flag.Var(&reqkeywords, "require-keyword", "Report files lacking a text chunk with this keyword (repeatable)")
+	flag.StringVar(&outname, "O", "", "Write results to this file instead of stdout")
+	flag.StringVar(&outname, "output", "", "Same as -O")
+	flag.StringVar(&pathmode, "path", "as-given", "How to print filenames: as-given, relative or absolute")
+	flag.IntVar(&largetext, "large-text", -1, "Report text chunks with a decoded value larger than this many bytes")
+	flag.StringVar(&sortby, "sort", "", "Sort output across all files, by: size (-large-text) or ratio (-match-ratio)")
+	flag.Var(&patterns, "e", "Search for this pattern (repeatable, any of them may match)")
+	flag.StringVar(&patternfile, "f", "", "Read patterns from this file, one per line (- for stdin)")
+	flag.BoolVar(&globpat, "g", false, "Treat the pattern as a shell-style glob instead of a regexp")
+	flag.BoolVar(&globpat, "glob", false, "Same as -g")
+	flag.BoolVar(&fixedpat, "F", false, "Treat the pattern as a literal string instead of a regexp")
+	flag.BoolVar(&fixedpat, "fixed-strings", false, "Same as -F")
+	flag.IntVar(&sample, "sample", 0, "Only search this many randomly selected files")
+	flag.Uint64Var(&seed, "seed", 0, "Random seed for -sample, to make the selection reproducible")
+	flag.StringVar(&aspect, "aspect", "", "Only consider images whose aspect ratio (w/h) matches, e.g. 16:9 or '>1.0'")
+	flag.Float64Var(&aspecttol, "aspect-tolerance", 0.01, "Relative tolerance for -aspect equality")
+	flag.StringVar(&hascolor, "has-color", "", "Only consider indexed-color images with this color (#rrggbb or #rrggbbaa) in their palette")
+	flag.IntVar(&colortol, "has-color-tolerance", 0, "How much every channel may differ from the color of -has-color")
+	flag.StringVar(&sdseed, "sd-seed", "", "Only consider images generated with this Stable Diffusion seed")
+	flag.StringVar(&sdmodelhash, "sd-model-hash", "", "Only consider images generated with the Stable Diffusion model with this hash")
+	flag.Float64Var(&mindpi, "min-dpi", 0, "Only consider images with a resolution (pHYs) of at least this many dots per inch")
+	flag.Var(&modafter, "modified-after", "Only consider images whose tIME chunk is at or after this date, e.g. 2022-01-01")
+	flag.Var(&modbefore, "modified-before", "Only consider images whose tIME chunk is before this date, e.g. 2023-01-01")
+	flag.StringVar(&keyfilter, "k", "", "Only search text chunks with this keyword, matching the regexp against the value")
+	flag.StringVar(&keyfilter, "key", "", "Same as -k")
+	flag.StringVar(&hexsearch, "hex", "", "Search the raw data of all chunks, including IDAT, for these bytes (e.g. 'DE AD ?? EF', ?? matching any byte)")
+	flag.StringVar(&chunktype, "chunk-type", "", "Also match against the raw data of chunks whose type matches this regexp (e.g. prVw or ^[a-z])")
+	flag.StringVar(&jsonpath, "jsonpath", "", "Match against the values this selector (e.g. $.a.b[0]) selects in text values that are JSON")
+	flag.StringVar(&xmpfield, "xmp-field", "", "Only search this XMP property (e.g. dc:creator), like -xmp -k")
+	flag.StringVar(&detect, "detect", "signature", "With -r, how to recognize PNG files: by their signature or their extension")
+	flag.Var(&includes, "include", "With -r, only search files whose name matches this glob instead of all PNG files (repeatable)")
+	flag.Var(&excludes, "exclude", "With -r, skip files whose name matches this glob (repeatable)")
+	flag.Var(&excludedirs, "exclude-dir", "With -r, skip directories whose name matches this glob (repeatable)")
+	flag.StringVar(&filesfrom, "files-from", "", "Also search the files listed in this file, one per line (- for stdin)")
+	flag.BoolVar(&nulsep, "0", false, "With -files-from, the names are separated by NUL bytes, as written by find -print0")
+	flag.BoolVar(&print0, "Z", false, "Terminate filenames with a NUL byte instead of a newline or separator, for xargs -0")
+	flag.BoolVar(&print0, "print0", false, "Same as -Z")
+	flag.StringVar(&colormode, "color", "auto", "Colorize filenames and matches: auto (if stdout is a terminal), always or never")
+	flag.DurationVar(&watchevery, "watch-interval", time.Second, "With -watch, how often to look for new and modified files")
+	flag.StringVar(&indexout, "build-index", "", "Write the metadata of the files to this index file, for fast searches with -index")
+	flag.StringVar(&indexfile, "index", "", "Search the metadata in this index file (built with -build-index) instead of reading unchanged files")
+	flag.StringVar(&serveaddr, "serve", "", "Answer search requests over HTTP on this address, e.g. localhost:8080")
+	flag.StringVar(&serveroot, "serve-root", "", "With -serve, let requests search the files below this directory with the path parameter")
+	flag.Int64Var(&servemaxsize, "serve-max-size", 64<<20, "With -serve, the largest image accepted in a request body, in bytes")
+	flag.BoolVar(&serveurls, "serve-urls", false, "With -serve, let requests search HTTP(S) URLs with the url parameter")
+	flag.StringVar(&metricsaddr, "metrics", "", "Serve Prometheus metrics on /metrics at this address, e.g. with -watch or -build-index")
+	flag.IntVar(&maxchunk, "max-chunk-size", 256<<20, "Treat files with a chunk larger than this many bytes as errors, to limit memory use (0 for no limit)")
+	flag.IntVar(&workers, "j", runtime.NumCPU(), "Number of files to search in parallel")
+	flag.StringVar(&fieldsep, "field-separator", ":", "Separator between the fields of an output line, e.g. '\\t'")
 	flag.Parse()
 	args := flag.Args()
-	if len(args) < 2 {
+	sep, err := parseSeparator(fieldsep)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fieldsep = sep
+	if aspect != "" {
+		c, err := parseComparison(aspect)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -aspect: %s\n", err)
+			os.Exit(2)
+		}
+		aspectcmp = &c
+	}
+	if hascolor != "" {
+		f, err := parseHexColor(hascolor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -has-color: %s\n", err)
+			os.Exit(2)
+		}
+		colorwant = &f
+	}
+	if colortol < 0 || colortol > 255 {
+		fmt.Fprintf(os.Stderr, "invalid -has-color-tolerance %d: must be 0-255\n", colortol)
+		os.Exit(2)
+	}
+	if sortby != "" && sortby != "size" && sortby != "ratio" {
+		fmt.Fprintf(os.Stderr, "invalid -sort '%s': must be size or ratio\n", sortby)
+		os.Exit(2)
+	}
+	if *jsonstream {
+		*jsonout = true
+	}
+	if *hexdump {
+		*showmatch = true
+	}
+	if *invert && (*matchname || *matchstruct || *scanidat || *scanlsb || *byteoffset || *onlymatching) {
+		fmt.Fprintln(os.Stderr, "-v can not be combined with -name, -match-structure, -scan-idat, -scan-lsb, -byte-offset or -o")
+		os.Exit(2)
+	}
+	for _, pats := range []stringList{includes, excludes, excludedirs} {
+		if err := checkGlobs(pats); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if *multi && *carve {
+		fmt.Fprintln(os.Stderr, "-multi and -carve are mutually exclusive")
+		os.Exit(2)
+	}
+	if *strict && *lenient {
+		fmt.Fprintln(os.Stderr, "-strict and -lenient are mutually exclusive")
+		os.Exit(2)
+	}
+	if *watch {
+		if sortby != "" || sample > 0 || *interactive {
+			fmt.Fprintln(os.Stderr, "-watch can not be combined with -sort, -sample or -interactive")
+			os.Exit(2)
+		}
+		if watchevery <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid -watch-interval %s: must be positive\n", watchevery)
+			os.Exit(2)
+		}
+		*recursive = true
+		*linebuf = true
+	}
+	if maxchunk < 0 {
+		fmt.Fprintf(os.Stderr, "invalid -max-chunk-size %d: must not be negative\n", maxchunk)
+		os.Exit(2)
+	}
+	if workers < 1 {
+		fmt.Fprintf(os.Stderr, "invalid -j %d: must be at least 1\n", workers)
+		os.Exit(2)
+	}
+	if chunktype != "" {
+		rx, err := regexp.Compile(chunktype)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -chunk-type '%s': %s\n", chunktype, err)
+			os.Exit(2)
+		}
+		chunkTypes = rx
+	}
+	if jsonpath != "" {
+		steps, err := parseJSONPath(jsonpath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		jsonPath = steps
+		*valueonly = true
+	}
+	if xmpfield != "" {
+		if keyfilter != "" && keyfilter != xmpfield {
+			fmt.Fprintln(os.Stderr, "-xmp-field can not be combined with -k")
+			os.Exit(2)
+		}
+		*xmpsearch = true
+		keyfilter = xmpfield
+	}
+	if keyfilter != "" {
+		*valueonly = true
+	}
+	if *keyonly && *valueonly {
+		fmt.Fprintln(os.Stderr, "-keyword can not be combined with -value, -k or -jsonpath")
+		os.Exit(2)
+	}
+	if *rawtext && (*keyonly || *valueonly) {
+		fmt.Fprintln(os.Stderr, "-raw-text can not be combined with -keyword, -value, -k or -jsonpath")
+		os.Exit(2)
+	}
+
+	if err := checkDetect(detect); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := checkPathMode(pathmode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if outname != "" {
+		if err := openOutput(outname); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if err := setupColor(colormode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(reqchunks) > 0 || len(reqkeywords) > 0 {
+		runFileMode("-require-chunk <type> | -require-keyword <keyword>", args, func(files iter.Seq[string]) int {
+			return checkRequirements(files, reqchunks, reqkeywords)
+		})
+	}
+	if largetext >= 0 {
+		runFileMode("-large-text <size>", args, func(files iter.Seq[string]) int {
+			return reportLargeText(files, largetext)
+		})
+	}
+	if *lint {
+		runFileMode("-lint", args, lintFiles)
+	}
+	if *benchmark {
+		if len(args) == 0 && filesfrom == "" {
+			exit(runBenchmark(nil))
+		}
+		runFileMode("-benchmark", args, runBenchmark)
+	}
+	if *check {
+		runFileMode("-check", args, checkChecksums)
+	}
+	if *secrets || *privacy || *polyglot {
+		if *redact && *polyglot {
+			fmt.Fprintln(os.Stderr, "-redact can not be combined with -polyglot")
+			os.Exit(2)
+		}
+		runFileMode("-secrets|-privacy-audit|-polyglot", args, func(files iter.Seq[string]) int {
+			switch {
+			case *redact && *privacy:
+				return replaceText(files, privacyRedactor(), "redacted")
+			case *redact:
+				return replaceText(files, secretsRedactor(), "redacted")
+			case *privacy:
+				return privacyAudit(files)
+			case *polyglot:
+				return polyglotAudit(files)
+			}
+			return scanSecrets(files)
+		})
+	}
+	if hexsearch != "" {
+		p, err := parseHexPattern(hexsearch)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		runFileMode("-hex <bytes>", args, func(files iter.Seq[string]) int {
+			return hexSearch(files, p)
+		})
+	}
+	if *dump {
+		runFileMode("-dump-chunks", args, dumpChunks)
+	}
+	if *info {
+		runFileMode("-info", args, printInfo)
+	}
+	if *iccout {
+		runFileMode("-extract-icc", args, extractICCProfiles)
+	}
+	if *thumbnail {
+		runFileMode("-extract-thumbnail", args, extractThumbnails)
+	}
+	if len(extract) > 0 {
+		runFileMode("-extract <type|index>", args, func(files iter.Seq[string]) int {
+			return extractChunks(files, extract)
+		})
+	}
+	if *checkcomp {
+		runFileMode("-check-text-compression", args, checkTextCompression)
+	}
+	if *strip {
+		runFileMode("-strip", args, stripFiles)
+	}
+	if *fixcrc {
+		runFileMode("-fix-crc", args, fixChecksums)
+	}
+	if *repair {
+		runFileMode("-repair", args, repairFiles)
+	}
+	if dedup != "" {
+		runFileMode("-dedup first|last", args, func(files iter.Seq[string]) int {
+			return dedupText(files, dedup)
+		})
+	}
+	if len(settext) > 0 {
+		runFileMode("-set <keyword=value>", args, func(files iter.Seq[string]) int {
+			return setText(files, settext)
+		})
+	}
+	if *checksum {
+		runFileMode("-checksum-summary", args, checksumSummary)
+	}
+	if metricsaddr != "" {
+		if err := startMetrics(metricsaddr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if indexout != "" {
+		if len(args) < 1 {
+			fmt.Fprintf(flag.CommandLine.Output(),
+				"Usage: %s -build-index <index> <file|dir> [file|dir, ...]\n", os.Args[0])
+			os.Exit(-1)
+		}
+		*recursive = true
+		exit(buildIndex(indexout, args))
+	}
+	if serveaddr != "" {
+		exit(serve(serveaddr))
+	}
+	pats := []string(patterns)
+	if patternfile != "" {
+		p, err := readPatterns(patternfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Reading patterns failed: %s\n", err)
+			os.Exit(2)
+		}
+		pats = append(pats, p...)
+	}
+	if len(pats) == 0 && len(args) > 0 {
+		pats, args = args[:1], args[1:]
+	}
+	var indexed []string
+	if indexfile != "" {
+		idx, paths, err := readIndex(indexfile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		index, indexed = idx, paths
+	}
+	if len(pats) == 0 || (len(args) < 1 && filesfrom == "" && indexfile == "") {
 		fmt.Fprintf(flag.CommandLine.Output(),
 			"Usage: %s [options] <regex> <file> [file, ...]\n", os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(-1)
 	}
-	re := args[0]
+	if globpat && fixedpat {
+		fmt.Fprintln(os.Stderr, "-g and -F are mutually exclusive")
+		os.Exit(2)
+	}
+	re, err := combinePatterns(pats)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	if *caseins {
 		re = "(?i)" + re
 	}
 	rx, err := regexp.Compile(re)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Invalid regexp '%s': %s\n", re, err)
-		os.Exit(2)
+		exit(2)
 	}
-	for _, filename := range args[1:] {
-		found, chunks, err := grepOneFile(filename, rx)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+	var st stats
+	ask := interactiveMode()
+	// The files are listed by the goroutine feeding the workers, so its
+	// errors are counted separately and only added up once it is done.
+	walkErrs := 0
+	files := inputFiles(args, &walkErrs)
+	if len(args) == 0 && filesfrom == "" {
+		// Without files, everything in the index is searched.
+		files = slices.Values(indexed)
+	}
+	// Closed when the search ends early, so -watch stops waiting for changes
+	// and searchFiles can finish.
+	stop := make(chan struct{})
+	if *watch {
+		files = watchFiles(args, watchevery, &walkErrs, stop)
+	}
+	if sample > 0 {
+		seeded := false
+		flag.Visit(func(f *flag.Flag) { seeded = seeded || f.Name == "seed" })
+		sampled := sampleFiles(files, sample, newRand(seed, seeded))
+		st.Sampled = len(sampled)
+		files = slices.Values(sampled)
+	}
+	replacing := false
+	flag.Visit(func(f *flag.Flag) { replacing = replacing || f.Name == "replace" })
+	if replacing || *redact {
+		edit := replaceWith(rx, replacement)
+		verb := "replaced text in"
+		if *redact {
+			edit, verb = redactWith(rx, nil), "redacted"
+		}
+		ret := replaceText(files, edit, verb)
+		if walkErrs > 0 {
 			ret = 2
-			break
 		}
-		if found {
-			fmt.Println(filename)
-			if *showmatch {
-				for _, m := range chunks {
-					fmt.Printf("%#v\n", m)
+		exit(ret)
+	}
+	searchContents := !*matchname || *contents
+	search := func(filename string) ([]result, error) {
+		if !searchContents {
+			return []result{{file: filename, label: filename}}, nil
+		}
+		return grepFile(filename, rx)
+	}
+files:
+	for j := range searchFiles(files, workers, search) {
+		filename := j.filename
+		if searchContents && *timing {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", displayName(filename), formatDuration(j.elapsed))
+			st.addTime(filename, j.elapsed)
+		}
+		if j.err != nil {
+			fmt.Fprintln(os.Stderr, j.err)
+			metrics.error()
+			st.Errors++
+			if *halt {
+				close(stop)
+				break
+			}
+			continue
+		}
+		st.Files++
+		for _, res := range j.results {
+			if res.err != nil {
+				// The other members of the archive are still searched.
+				fmt.Fprintln(os.Stderr, res.err)
+				metrics.error()
+				st.Errors++
+				if *halt {
+					close(stop)
+					break files
+				}
+				continue
+			}
+			if res.decodeErr != nil {
+				// The image is still searched, but the exit status tells
+				// that it is broken.
+				fmt.Fprintf(os.Stderr, "%s: image data does not decode: %s\n", displayName(res.label), res.decodeErr)
+				metrics.error()
+				st.Errors++
+			}
+			res.name = *matchname && rx.MatchString(filename)
+			metrics.file(res.png)
+			if res.found() {
+				metrics.match()
+			}
+			if *quiet {
+				// Like grep, a match means success even after errors.
+				if res.found() {
+					exit(0)
+				}
+				continue
+			}
+			switch {
+			case *fileswith:
+				if res.found() {
+					printFields(colorName(displayName(res.label)))
+					endRecord()
+				}
+			case *fileswithout:
+				if !res.found() {
+					printFields(colorName(displayName(res.label)))
+					endRecord()
+					ret = 0
+				}
+				continue
+			case *jsonout:
+				if res.found() {
+					printJSON(res, rx)
+				}
+			case *count:
+				printCount(res, rx)
+			case *matchratio:
+				printRatio(res)
+			case res.found():
+				printMatch(res, rx)
+			}
+			if res.found() {
+				st.Matches++
+				ret = 0
+				if ask && !review(res) {
+					close(stop)
+					break files
 				}
 			}
-			ret = 0
 		}
 	}
-	os.Exit(ret)
+	// searchFiles has waited for the feeding goroutine to finish.
+	st.Errors += walkErrs
+	// Like grep, errors take precedence over matches.
+	if st.Errors > 0 {
+		ret = 2
+	}
+	flushRatios()
+	if *jsonstream {
+		writeJSON(jsonSummary{st})
+	}
+	if *summary {
+		st.print(os.Stderr)
+	}
+	exit(ret)
+}
+
+// result holds everything that matched in one file
+type result struct {
+	file   string       // the file searched
+	label  string       // the filename, with -multi followed by #index
+	png    *pngmeta.PNG // the image searched, nil if only the filename was
+	name   bool         // the filename matched
+	chunks []textMatch  // matching text chunks
+	idat   []idatMatch  // matches in the decompressed image data
+	lsb    []lsbMatch   // matches in text hidden in the pixels
+	// The chunk structure, if it matched
+	structure string
+	// The number of text chunks searched
+	textchunks int
+	// The text chunks were searched, i.e. the image passed all filters
+	searched bool
+	// With -decode-check, why the image data does not decode, if it doesn't
+	decodeErr error
+	// Why a member of an archive could not be searched. Only file and label
+	// are set then.
+	err error
 }
 
-func grepOneFile(filename string, rx *regexp.Regexp) (bool, []string, error) {
-	file, err := os.Open(filename)
+// idatMatch is a match in the decompressed image data
+type idatMatch struct {
+	offset int
+	text   []byte
+}
+
+// found reports whether anything matched. With -v, that is the case if no
+// text chunk matched, even if there are no text chunks at all.
+func (r result) found() bool {
+	if *invert {
+		return r.searched && len(r.chunks) == r.textchunks
+	}
+	return r.name || len(r.chunks) > 0 || len(r.idat) > 0 || len(r.lsb) > 0 || r.structure != ""
+}
+
+// runFileMode runs a mode that works on files instead of searching them and
+// exits with its exit code. The mode gets the files given as arguments and
+// with -files-from, with directories walked with -r, like a search. Problems
+// listing the files make the exit code 2.
+func runFileMode(usage string, args []string, mode func(iter.Seq[string]) int) {
+	if len(args) < 1 && filesfrom == "" {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s %s <file> [file, ...]\n", os.Args[0], usage)
+		os.Exit(-1)
+	}
+	errs := 0
+	ret := mode(inputFiles(args, &errs))
+	if errs > 0 {
+		ret = 2
+	}
+	exit(ret)
+}
+
+func printMatch(res result, rx *regexp.Regexp) {
+	filename := colorName(displayName(res.label))
+	if *showtype {
+		if res.name {
+			printFields(filename, "name")
+		}
+		for _, t := range matchedTypes(res.chunks) {
+			printFields(filename, t)
+		}
+	} else if *byteoffset {
+		if res.name {
+			printFields(filename)
+		}
+		for _, m := range res.chunks {
+			printOffsets(filename, m, rx)
+		}
+	} else if *onlymatching {
+		if res.name {
+			printFields(filename)
+		}
+		for _, m := range res.chunks {
+			printOnlyMatching(filename, m, rx)
+		}
+	} else if res.name || len(res.chunks) > 0 || *invert {
+		printFields(filename)
+	}
+	if res.structure != "" {
+		printFields(filename, res.structure)
+	}
+	if *showmatch {
+		for _, m := range res.chunks {
+			if *hexdump {
+				text := m.text
+				if rawChunk(m.chunk) {
+					// Dump the chunk data as it is, without the empty keyword.
+					text = strings.TrimPrefix(text, "\x00")
+				}
+				fmt.Fprint(out, hex.Dump([]byte(text)))
+				continue
+			}
+			var locs [][]int
+			// Offsets in normalized text can not be highlighted in the
+			// original, and with -v there is nothing to highlight.
+			if !*normspace && !*invert {
+				locs = findText(m.text, rx)
+			}
+			fmt.Fprintln(out, highlight(m.text, locs))
+		}
+	}
+	for _, m := range res.idat {
+		printFields(filename, fmt.Sprintf("IDAT[decompressed+%d]", m.offset), quoteMatch(string(m.text)))
+	}
+	for _, m := range res.lsb {
+		printFields(filename, fmt.Sprintf("LSB[%s+%d]", m.plane, m.offset), quoteMatch(string(m.text)))
+	}
+	endRecord()
+}
+
+// printCount prints the number of matches in a file. By default, that is the
+// number of matching chunks; with -per-chunk, it is the number of times the
+// regexp matches in all of them.
+func printCount(res result, rx *regexp.Regexp) {
+	n := len(res.chunks)
+	if *perchunk {
+		n = 0
+		for _, m := range res.chunks {
+			n += len(findText(m.text, rx))
+		}
+	}
+	n += len(res.idat) + len(res.lsb)
+	if res.name {
+		n++
+	}
+	printFields(colorName(displayName(res.label)), n)
+	endRecord()
+}
+
+// grepFile searches the named file. It returns one result, or with -multi one
+// result for every PNG found in the file.
+func grepFile(filename string, rx *regexp.Regexp) ([]result, error) {
+	opts := searchOptions()
+	if isArchive(filename) {
+		return grepArchive(filename, rx, opts)
+	}
+	if *carve {
+		return carveFile(filename, rx, opts)
+	}
+	if png, ok := indexedPNG(filename); ok {
+		return []result{grepPNG(result{file: filename, label: filename}, png, rx)}, nil
+	}
+	if !*multi {
+		png, err := loadFileWithOptions(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := reportMismatches(filename, png); err != nil {
+			return nil, err
+		}
+		return []result{grepPNG(result{file: filename, label: filename}, png, rx)}, nil
+	}
+	file, err := openImage(filename)
 	if err != nil {
-		return false, []string{}, err
+		return nil, err
 	}
 	defer file.Close()
-	found, chunk, err := grePNG(file, rx)
+	return grepAll(filename, filename, file, rx, opts)
+}
+
+// grepAll searches all PNGs concatenated in the data read from r, for
+// -multi. The results are labeled name#index.
+func grepAll(filename, name string, r io.Reader, rx *regexp.Regexp, opts pngmeta.LoadOptions) ([]result, error) {
+	pngs, err := loadReaderAll(name, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d PNGs\n", displayName(name), len(pngs))
+	results := make([]result, len(pngs))
+	for i, png := range pngs {
+		label := fmt.Sprintf("%s#%d", name, i+1)
+		if err := reportMismatches(label, png); err != nil {
+			return nil, err
+		}
+		results[i] = grepPNG(result{file: filename, label: label}, png, rx)
+	}
+	return results, nil
+}
+
+// searchOptions returns the options to load images with for searching them
+func searchOptions() pngmeta.LoadOptions {
+	// The image data is only needed for -scan-idat, -scan-lsb, -stealth and
+	// -decode-check, and if -chunk-type selects it.
+	return pngmeta.LoadOptions{
+		SkipImageData:   !*scanidat && !*scanlsb && !*stealth && !*decodechk && !rawImageData(),
+		VerifyChecksums: *crccheck || *crcstrict,
+	}
+}
+
+// grepPNG searches one PNG, adding the matches to res.
+func grepPNG(res result, png pngmeta.PNG, rx *regexp.Regexp) result {
+	res.png = &png
+	if !selectPNG(png) {
+		return res
+	}
+	if *matchstruct {
+		if st := png.Structure(); rx.MatchString(st) {
+			res.structure = st
+		}
+		return res
+	}
+	res.chunks, res.textchunks = grePNG(png, rx)
+	res.searched = true
+	if *decodechk {
+		_, res.decodeErr = decodeImage(png)
+	}
+	if *scanidat && !(*fileswith && len(res.chunks) > 0) {
+		// A broken image data stream is not an error for the text search, so
+		// we only search whatever could be decompressed.
+		data, _ := png.DecompressImageData()
+		for _, loc := range rx.FindAllIndex(data, -1) {
+			res.idat = append(res.idat, idatMatch{loc[0], data[loc[0]:loc[1]]})
+		}
+	}
+	if *scanlsb && !(*fileswith && res.found()) {
+		res.lsb = scanLSB(png, rx)
+	}
+	return res
+}
+
+// selectPNG reports whether the image passes all filters given on the
+// command line. Images that don't are not searched.
+func selectPNG(png pngmeta.PNG) bool {
+	if *stereo {
+		if _, ok := png.StereoMode(); !ok {
+			return false
+		}
+	}
+	if *trailing && len(png.Trailing) == 0 {
+		return false
+	}
+	if (sdseed != "" || sdmodelhash != "") && !sdSelected(png) {
+		return false
+	}
+	if mindpi > 0 {
+		p, _ := png.Phys()
+		// Without a resolution in meters, the DPI are unknown.
+		x, y, ok := p.DPI()
+		if !ok || min(x, y) < mindpi {
+			return false
+		}
+	}
+	if modafter.set || modbefore.set {
+		t, ok := png.ModTime()
+		if !ok || (modafter.set && t.Before(modafter.Time)) || (modbefore.set && !t.Before(modbefore.Time)) {
+			return false
+		}
+	}
+	if aspectcmp != nil {
+		if !aspectcmp.match(float64(png.Width)/float64(png.Height), aspecttol) {
+			return false
+		}
+	}
+	if colorwant != nil && !colorwant.match(png, colortol) {
+		return false
+	}
+	return true
+}
+
+// openFile opens the named file for reading, standard input for "-", or
+// downloads it if it is an HTTP(S) URL.
+func openFile(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if isURL(filename) {
+		return openURL(filename)
+	}
+	return os.Open(filename)
+}
+
+// loadFile opens and parses the named file, printing any parse warnings if
+// requested.
+func loadFile(filename string) (pngmeta.PNG, error) {
+	return loadFileWithOptions(filename, pngmeta.LoadOptions{})
+}
+
+// loadFileWithOptions is loadFile with options. Warnings are collected
+// according to -warnings.
+func loadFileWithOptions(filename string, opts pngmeta.LoadOptions) (pngmeta.PNG, error) {
+	file, err := openImage(filename)
 	if err != nil {
-		return false, []string{}, err
+		return pngmeta.PNG{}, err
 	}
-	return found, chunk, nil
+	defer file.Close()
+	// Don't download image data that is not needed anyway.
+	opts.SeekImageData = opts.SkipImageData && isURL(filename)
+	return loadReader(filename, file, opts)
 }
 
-func grePNG(r io.Reader, rx *regexp.Regexp) (bool, []string, error) {
-	var chunks []string
-	png, err := Load(r)
+// loadReader parses a PNG read from r, like loadFileWithOptions. The name is
+// used in warnings and errors. Unless opts sets a smaller one, the chunk size
+// is limited by -max-chunk-size.
+func loadReader(name string, r io.Reader, opts pngmeta.LoadOptions) (pngmeta.PNG, error) {
+	opts.Warnings = *warnings
+	opts.Strict, opts.Lenient = *strict, *lenient
+	if opts.MaxChunkSize == 0 {
+		opts.MaxChunkSize = maxchunk
+	}
+	png, err := pngmeta.LoadWithOptions(r, opts)
+	for _, w := range png.Warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", name, w)
+	}
 	if err != nil {
-		return false, chunks, err
+		return png, fmt.Errorf("%s: %w", displayName(name), err)
 	}
+	return png, nil
+}
 
-	for _, tc := range png.GetTextChunks() {
-		ret := rx.FindStringIndex(tc)
-		if ret != nil {
-			chunks = append(chunks, tc)
+// loadReaderAll parses all PNGs read from r, like loadReader.
+func loadReaderAll(name string, r io.Reader, opts pngmeta.LoadOptions) ([]pngmeta.PNG, error) {
+	opts.Warnings = *warnings
+	opts.Strict, opts.Lenient = *strict, *lenient
+	opts.MaxChunkSize = maxchunk
+	pngs, err := pngmeta.LoadAll(r, opts)
+	for i, png := range pngs {
+		for _, w := range png.Warnings {
+			fmt.Fprintf(os.Stderr, "%s#%d: warning: %s\n", name, i+1, w)
 		}
 	}
-	return len(chunks) > 0, chunks, nil
+	if err != nil {
+		return pngs, fmt.Errorf("%s#%d: %w", displayName(name), len(pngs), err)
+	}
+	return pngs, nil
 }
@@ -0,0 +1,166 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// chunkSizeBuckets are the upper bounds of the buckets of the chunk size
+// histograms, in bytes
+var chunkSizeBuckets = []int{16, 256, 4096, 65536, 1 << 20, 16 << 20}
+
+// metricSet holds the counters exposed on /metrics, in the Prometheus text
+// format. A nil *metricSet counts nothing, so the counting functions can be
+// called unconditionally.
+type metricSet struct {
+	mu      sync.Mutex
+	files   int64
+	matches int64
+	errors  int64
+	bytes   int64
+	chunks  map[string]*histogram
+}
+
+// histogram counts observations by chunkSizeBuckets
+type histogram struct {
+	buckets []int64 // not cumulative, the last one is +Inf
+	sum     int64
+	count   int64
+}
+
+// metrics is set if metrics are collected, with -serve or -metrics
+var metrics *metricSet
+
+func newMetrics() *metricSet {
+	return &metricSet{chunks: map[string]*histogram{}}
+}
+
+// startMetrics listens on addr and serves /metrics there in the background.
+func startMetrics(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	metrics = newMetrics()
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics)
+	go func() {
+		fmt.Fprintln(os.Stderr, http.Serve(ln, mux))
+	}()
+	return nil
+}
+
+// file counts a file that was searched, and the size of its chunks.
+func (m *metricSet) file(png *pngmeta.PNG) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files++
+	if png == nil {
+		return
+	}
+	m.bytes += int64(len(png.Signature) + len(png.Trailing))
+	for _, c := range png.Chunks {
+		m.bytes += 12 + int64(c.Len)
+		t := metricsChunkType(c.Type)
+		h := m.chunks[t]
+		if h == nil {
+			h = &histogram{buckets: make([]int64, len(chunkSizeBuckets)+1)}
+			m.chunks[t] = h
+		}
+		i, _ := slices.BinarySearch(chunkSizeBuckets, c.Len)
+		h.buckets[i]++
+		h.sum += int64(c.Len)
+		h.count++
+	}
+}
+
+// metricsChunkType returns the label of a chunk type in the chunk size
+// histograms. Chunk types are only valid if they are four ASCII letters, and
+// all others share the label "other", so broken or malicious files can not
+// create any number of histograms, or labels that are not valid UTF-8.
+func metricsChunkType(t string) string {
+	if len(t) != 4 {
+		return "other"
+	}
+	for _, b := range []byte(t) {
+		if !('A' <= b && b <= 'Z' || 'a' <= b && b <= 'z') {
+			return "other"
+		}
+	}
+	return t
+}
+
+// match counts a file with a match.
+func (m *metricSet) match() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.matches++
+	m.mu.Unlock()
+}
+
+// error counts a file that could not be read or parsed.
+func (m *metricSet) error() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.errors++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *metricSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.write(w)
+}
+
+func (m *metricSet) write(w io.Writer) {
+	counters := []struct {
+		name, help string
+		value      int64
+	}{
+		{"pngrep_files_scanned_total", "Files searched.", m.files},
+		{"pngrep_matches_total", "Files with a match.", m.matches},
+		{"pngrep_errors_total", "Files that could not be read or parsed.", m.errors},
+		{"pngrep_bytes_read_total", "Bytes of PNG data parsed.", m.bytes},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value)
+	}
+	const name = "pngrep_chunk_size_bytes"
+	fmt.Fprintf(w, "# HELP %s Size of the chunks parsed, by chunk type.\n# TYPE %s histogram\n", name, name)
+	types := make([]string, 0, len(m.chunks))
+	for t := range m.chunks {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	for _, t := range types {
+		h := m.chunks[t]
+		// No escaping needed, see metricsChunkType
+		label := `"` + t + `"`
+		var n int64
+		for i, le := range chunkSizeBuckets {
+			n += h.buckets[i]
+			fmt.Fprintf(w, "%s_bucket{type=%s,le=\"%d\"} %d\n", name, label, le, n)
+		}
+		fmt.Fprintf(w, "%s_bucket{type=%s,le=\"+Inf\"} %d\n", name, label, h.count)
+		fmt.Fprintf(w, "%s_sum{type=%s} %d\n%s_count{type=%s} %d\n", name, label, h.sum, name, label, h.count)
+	}
+}
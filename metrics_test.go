@@ -0,0 +1,84 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := newMetrics()
+	m.file(&pngmeta.PNG{
+		Signature: []byte(pngmeta.PNGMagic),
+		Chunks: []*pngmeta.Chunk{
+			{Type: "IHDR", Len: 13},
+			{Type: "tEXt", Len: 300},
+			{Type: "\xff\x00\"\n", Len: 5},
+			{Type: "12ab", Len: 70000},
+			{Type: "IEND", Len: 0},
+		},
+	})
+	m.file(nil)
+	m.match()
+	m.error()
+	var buf bytes.Buffer
+	m.write(&buf)
+	want := `# HELP pngrep_files_scanned_total Files searched.
+# TYPE pngrep_files_scanned_total counter
+pngrep_files_scanned_total 2
+# HELP pngrep_matches_total Files with a match.
+# TYPE pngrep_matches_total counter
+pngrep_matches_total 1
+# HELP pngrep_errors_total Files that could not be read or parsed.
+# TYPE pngrep_errors_total counter
+pngrep_errors_total 1
+# HELP pngrep_bytes_read_total Bytes of PNG data parsed.
+# TYPE pngrep_bytes_read_total counter
+pngrep_bytes_read_total 70386
+# HELP pngrep_chunk_size_bytes Size of the chunks parsed, by chunk type.
+# TYPE pngrep_chunk_size_bytes histogram
+pngrep_chunk_size_bytes_bucket{type="IEND",le="16"} 1
+pngrep_chunk_size_bytes_bucket{type="IEND",le="256"} 1
+pngrep_chunk_size_bytes_bucket{type="IEND",le="4096"} 1
+pngrep_chunk_size_bytes_bucket{type="IEND",le="65536"} 1
+pngrep_chunk_size_bytes_bucket{type="IEND",le="1048576"} 1
+pngrep_chunk_size_bytes_bucket{type="IEND",le="16777216"} 1
+pngrep_chunk_size_bytes_bucket{type="IEND",le="+Inf"} 1
+pngrep_chunk_size_bytes_sum{type="IEND"} 0
+pngrep_chunk_size_bytes_count{type="IEND"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="16"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="256"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="4096"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="65536"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="1048576"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="16777216"} 1
+pngrep_chunk_size_bytes_bucket{type="IHDR",le="+Inf"} 1
+pngrep_chunk_size_bytes_sum{type="IHDR"} 13
+pngrep_chunk_size_bytes_count{type="IHDR"} 1
+pngrep_chunk_size_bytes_bucket{type="other",le="16"} 1
+pngrep_chunk_size_bytes_bucket{type="other",le="256"} 1
+pngrep_chunk_size_bytes_bucket{type="other",le="4096"} 1
+pngrep_chunk_size_bytes_bucket{type="other",le="65536"} 1
+pngrep_chunk_size_bytes_bucket{type="other",le="1048576"} 2
+pngrep_chunk_size_bytes_bucket{type="other",le="16777216"} 2
+pngrep_chunk_size_bytes_bucket{type="other",le="+Inf"} 2
+pngrep_chunk_size_bytes_sum{type="other"} 70005
+pngrep_chunk_size_bytes_count{type="other"} 2
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="16"} 0
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="256"} 0
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="4096"} 1
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="65536"} 1
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="1048576"} 1
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="16777216"} 1
+pngrep_chunk_size_bytes_bucket{type="tEXt",le="+Inf"} 1
+pngrep_chunk_size_bytes_sum{type="tEXt"} 300
+pngrep_chunk_size_bytes_count{type="tEXt"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
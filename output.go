@@ -0,0 +1,131 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// out is where all results are written to. It is buffered for throughput and
+// must be flushed before exiting, see exit().
+var (
+	out     = bufio.NewWriter(os.Stdout)
+	outfile *os.File
+)
+
+// openOutput redirects all results to the named file, creating or truncating
+// it.
+func openOutput(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("cannot open output file: %w", err)
+	}
+	outfile = f
+	out = bufio.NewWriter(f)
+	return nil
+}
+
+// printFields prints one line of output made up of the given fields,
+// separated by the -field-separator. The first field is the filename. With
+// -Z, it is terminated by a NUL byte instead of the separator, or instead of
+// the newline if it is the only field.
+func printFields(fields ...any) {
+	for i, f := range fields {
+		if i == 1 && print0 {
+			out.WriteByte(0)
+		} else if i > 0 {
+			out.WriteString(fieldsep)
+		}
+		fmt.Fprint(out, f)
+	}
+	if len(fields) == 1 && print0 {
+		out.WriteByte(0)
+		return
+	}
+	out.WriteByte('\n')
+}
+
+// parseSeparator interprets backslash escapes like \t in the value of the
+// -field-separator flag, so a tab can be given without shell quoting tricks.
+func parseSeparator(sep string) (string, error) {
+	if sep == "" {
+		return "", fmt.Errorf("field separator must not be empty")
+	}
+	if unq, err := strconv.Unquote(`"` + sep + `"`); err == nil && unq != "" {
+		return unq, nil
+	}
+	return sep, nil
+}
+
+// endRecord is called after the output for one match has been written. With
+// -line-buffered, it flushes the output so results show up immediately.
+func endRecord() {
+	if *linebuf {
+		out.Flush()
+	}
+}
+
+// exit flushes and closes the output and terminates the program.
+func exit(code int) {
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing output failed: %s\n", err)
+		code = 2
+	}
+	if outfile != nil {
+		if err := outfile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Closing output file failed: %s\n", err)
+			code = 2
+		}
+	}
+	os.Exit(code)
+}
+
+// checkPathMode validates the value of the -path flag.
+func checkPathMode(mode string) error {
+	switch mode {
+	case "as-given", "relative", "absolute":
+		return nil
+	}
+	return fmt.Errorf("invalid -path '%s': must be one of as-given, relative, absolute", mode)
+}
+
+// displayName returns the filename as it should be printed, according to the
+// -path flag. With -path=relative, files found while walking a directory with
+// -r are shown relative to that directory, all others relative to the
+// current directory. If the filename cannot be converted, it is returned
+// unchanged.
+// Standard input, given as "-", is shown as "(standard input)".
+func displayName(filename string) string {
+	if filename == "-" {
+		return "(standard input)"
+	}
+	if isURL(filename) {
+		return filename
+	}
+	switch pathmode {
+	case "absolute":
+		if abs, err := filepath.Abs(filename); err == nil {
+			return abs
+		}
+	case "relative":
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			break
+		}
+		base := walkRoot(filename)
+		if base == "" {
+			if base, err = os.Getwd(); err != nil {
+				break
+			}
+		}
+		if rel, err := filepath.Rel(base, abs); err == nil {
+			return rel
+		}
+	}
+	return filename
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// colorFilter is a parsed -has-color
+type colorFilter struct {
+	color color.NRGBA
+	// alpha is set if the color was given with an alpha value, which then
+	// has to match, too.
+	alpha bool
+}
+
+// parseHexColor parses a color for -has-color: #rrggbb, or #rrggbbaa with an
+// alpha value. The # is optional.
+func parseHexColor(s string) (colorFilter, error) {
+	digits := strings.TrimPrefix(s, "#")
+	if len(digits) != 6 && len(digits) != 8 {
+		return colorFilter{}, fmt.Errorf("invalid color '%s': must be #rrggbb or #rrggbbaa", s)
+	}
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return colorFilter{}, fmt.Errorf("invalid color '%s': must be #rrggbb or #rrggbbaa", s)
+	}
+	if len(digits) == 6 {
+		v = v<<8 | 0xff
+	}
+	c := color.NRGBA{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	return colorFilter{c, len(digits) == 8}, nil
+}
+
+// match reports whether any entry of the palette of an indexed-color image
+// has the color, every channel differing by at most tolerance.
+func (f colorFilter) match(png pngmeta.PNG, tolerance int) bool {
+	if png.ColorType != 3 {
+		return false
+	}
+	palette, _ := png.Palette()
+	near := func(a, b uint8) bool {
+		return max(a, b)-min(a, b) <= uint8(tolerance)
+	}
+	for _, c := range palette {
+		if near(c.R, f.color.R) && near(c.G, f.color.G) && near(c.B, f.color.B) &&
+			(!f.alpha || near(c.A, f.color.A)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hexColor formats a palette entry as #rrggbb, or #rrggbbaa if it is not
+// opaque.
+func hexColor(c color.NRGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// combinePatterns turns the patterns given with -e, -f or on the command line
+// into a single regexp that matches if any of them does. With -g, every
+// pattern is a glob, and with -F a literal string.
+func combinePatterns(pats []string) (string, error) {
+	res := make([]string, len(pats))
+	for i, p := range pats {
+		switch {
+		case globpat:
+			var err error
+			if p, err = globToRegexp(p); err != nil {
+				return "", err
+			}
+		case fixedpat:
+			p = regexp.QuoteMeta(p)
+		}
+		res[i] = p
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return "(?:" + strings.Join(res, ")|(?:") + ")", nil
+}
+
+// readPatterns reads the patterns for -f, one per line, from the named file
+// or standard input for "-". Empty lines are ignored.
+func readPatterns(filename string) ([]string, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var pats []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSuffix(sc.Text(), "\r"); line != "" {
+			pats = append(pats, line)
+		}
+	}
+	return pats, sc.Err()
+}
@@ -0,0 +1,183 @@
+// Parsers for ancillary chunks.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Stereo layout modes as stored in the sTER chunk
+const (
+	StereoCrossFuse = 0
+	StereoDiverging = 1
+)
+
+// StereoMode returns the layout mode of a stereoscopic image, as stored in
+// the sTER chunk. It returns ok=false if the image has no (valid) sTER chunk.
+//
+// From https://www.w3.org/TR/png/#11sTER
+// ```
+// The sTER chunk contains:
+//
+// Mode: 1 byte
+//
+// 0: cross-fuse layout
+// 1: diverging-fuse layout
+// ```
+func (png PNG) StereoMode() (byte, bool) {
+	chunks := png.GetChunksByType("sTER")
+	if len(chunks) == 0 || len(chunks[0].Data) != 1 {
+		return 0, false
+	}
+	mode := chunks[0].Data[0]
+	if mode != StereoCrossFuse && mode != StereoDiverging {
+		return 0, false
+	}
+	return mode, true
+}
+
+// ModTime returns the time of the last modification of the image, as stored
+// in the tIME chunk. It returns ok=false if the image has no (valid) tIME
+// chunk.
+//
+// From https://www.w3.org/TR/png/#11tIME
+// ```
+// The tIME chunk contains:
+//
+// Year:   2 bytes (complete; for example, 1995, not 95)
+// Month:  1 byte (1-12)
+// Day:    1 byte (1-31)
+// Hour:   1 byte (0-23)
+// Minute: 1 byte (0-59)
+// Second: 1 byte (0-60) (to allow for leap seconds)
+//
+// Universal Time (UTC) should be specified rather than local time.
+// ```
+func (png PNG) ModTime() (time.Time, bool) {
+	chunks := png.GetChunksByType("tIME")
+	if len(chunks) == 0 || len(chunks[0].Data) != 7 {
+		return time.Time{}, false
+	}
+	d := chunks[0].Data
+	month, day, hour, minute, second := int(d[2]), int(d[3]), int(d[4]), int(d[5]), int(d[6])
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 60 {
+		return time.Time{}, false
+	}
+	year := int(binary.BigEndian.Uint16(d[0:2]))
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC), true
+}
+
+// Units of the pixel dimensions in the pHYs chunk
+const (
+	PhysUnknown = 0
+	PhysMeter   = 1
+)
+
+// Phys holds the intended pixel size or aspect ratio of an image, as stored
+// in the pHYs chunk.
+type Phys struct {
+	// PixelsPerUnitX and PixelsPerUnitY are the number of pixels per unit,
+	// horizontally and vertically.
+	PixelsPerUnitX uint32
+	PixelsPerUnitY uint32
+	// Unit is PhysMeter, or PhysUnknown if the values only define the pixel
+	// aspect ratio.
+	Unit byte
+}
+
+// DPI returns the resolution in dots (pixels) per inch, rounded to two
+// decimals: pixels per meter are whole numbers, so 300 DPI are stored as
+// 11811, which is 299.9994 DPI. It returns ok=false if the unit is unknown.
+func (p Phys) DPI() (x, y float64, ok bool) {
+	if p.Unit != PhysMeter {
+		return 0, 0, false
+	}
+	const inch = 0.0254 // meters
+	dpi := func(ppm uint32) float64 {
+		return math.Round(float64(ppm)*inch*100) / 100
+	}
+	return dpi(p.PixelsPerUnitX), dpi(p.PixelsPerUnitY), true
+}
+
+// Phys returns the physical pixel dimensions stored in the pHYs chunk. It
+// returns ok=false if the image has no (valid) pHYs chunk.
+//
+// From https://www.w3.org/TR/png/#11pHYs
+// ```
+// The pHYs chunk contains:
+//
+// Pixels per unit, X axis: 4 bytes (PNG unsigned integer)
+// Pixels per unit, Y axis: 4 bytes (PNG unsigned integer)
+// Unit specifier:          1 byte
+//
+// The following values are defined for the unit specifier:
+//
+// 0: unit is unknown
+// 1: unit is the metre
+// ```
+func (png PNG) Phys() (Phys, bool) {
+	chunks := png.GetChunksByType("pHYs")
+	if len(chunks) == 0 || len(chunks[0].Data) != 9 {
+		return Phys{}, false
+	}
+	d := chunks[0].Data
+	p := Phys{
+		PixelsPerUnitX: binary.BigEndian.Uint32(d[0:4]),
+		PixelsPerUnitY: binary.BigEndian.Uint32(d[4:8]),
+		Unit:           d[8],
+	}
+	if p.Unit > PhysMeter {
+		return Phys{}, false
+	}
+	return p, true
+}
+
+// ICCProfile returns the name and the decompressed data of the embedded ICC
+// color profile, as stored in the iCCP chunk. An error is returned if there is
+// no iCCP chunk, it is malformed or the profile cannot be decompressed.
+//
+// From https://www.w3.org/TR/png/#11iCCP
+// ```
+// The iCCP chunk contains:
+//
+// Profile name:       1-79 bytes (character string)
+// Null separator:     1 byte (null character)
+// Compression method: 1 byte
+// Compressed profile: n bytes
+// ```
+func (png PNG) ICCProfile() (string, []byte, error) {
+	chunks := png.GetChunksByType("iCCP")
+	if len(chunks) == 0 {
+		return "", nil, fmt.Errorf("no iCCP chunk")
+	}
+	name, ok := chunks[0].ICCProfileName()
+	if !ok {
+		return "", nil, fmt.Errorf("malformed iCCP chunk")
+	}
+	profile, err := inflate(chunks[0].Data[len(name)+2:])
+	if err != nil {
+		return name, nil, fmt.Errorf("iCCP profile %q: %w", name, err)
+	}
+	return name, profile, nil
+}
+
+// ICCProfileName returns the profile name of an iCCP chunk. ok is false for
+// other chunks and malformed iCCP chunks.
+func (c *Chunk) ICCProfileName() (string, bool) {
+	if c.Type != "iCCP" {
+		return "", false
+	}
+	name, rest, found := bytes.Cut(c.Data, []byte{0})
+	if !found || len(rest) < 1 {
+		return "", false
+	}
+	return string(name), true
+}
@@ -0,0 +1,119 @@
+// Finding PNGs embedded in arbitrary data.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"iter"
+)
+
+// carveBufferSize is the size of the window Carve searches for signatures
+const carveBufferSize = 64 << 10
+
+// carveReplayLimit is the most data read for a PNG that could not be parsed
+// that Carve searches again for signatures
+const carveReplayLimit = 1 << 20
+
+// Carved is a PNG found by Carve. Err is set if it could not be parsed, PNG
+// then holds what could be read.
+type Carved struct {
+	// Offset is the position of the PNG signature in the input
+	Offset int64
+	PNG    PNG
+	Err    error
+}
+
+// Carve scans r for PNG signatures (or opts.Signature) anywhere in the data,
+// e.g. in memory dumps or firmware images, and parses a PNG at every one
+// found. The offsets of the chunks are relative to the start of r. Scanning
+// resumes after the end of every PNG. After a PNG that could not be parsed,
+// it resumes right after its signature, unless more than carveReplayLimit
+// bytes were read for it, then after those. Data after IEND is not read into
+// PNG.Trailing. A problem reading r ends the sequence with an error that has
+// no PNG.
+func Carve(r io.Reader, opts LoadOptions) iter.Seq[Carved] {
+	magic := []byte(opts.Signature)
+	if len(magic) == 0 {
+		magic = []byte(PNGMagic)
+	}
+	return func(yield func(Carved) bool) {
+		rr := &replayReader{r: r}
+		br := bufio.NewReaderSize(rr, carveBufferSize)
+		var pos int64
+		for {
+			buf, err := br.Peek(carveBufferSize)
+			if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+				yield(Carved{Offset: pos, Err: err})
+				return
+			}
+			i := bytes.Index(buf, magic)
+			if i < 0 {
+				if err == io.EOF {
+					return
+				}
+				// Keep what could be the start of a signature.
+				n := max(len(buf)-len(magic)+1, 1)
+				br.Discard(n)
+				pos += int64(n)
+				continue
+			}
+			br.Discard(i)
+			pos += int64(i)
+			cr := &countingReader{r: br}
+			png, _, err := load(cr, opts, pos)
+			if !yield(Carved{Offset: pos, PNG: png, Err: err}) {
+				return
+			}
+			if err != nil && cr.n <= carveReplayLimit {
+				// Another PNG may start within what was read. It is read
+				// again, followed by what br has buffered beyond it.
+				pos++
+				buffered, _ := br.Peek(br.Buffered())
+				replay := append(cr.data[1:], buffered...)
+				rr.replay = append(replay, rr.replay...)
+				br.Reset(rr)
+				continue
+			}
+			pos += cr.n
+		}
+	}
+}
+
+// countingReader counts the bytes read through it, and keeps the first
+// carveReplayLimit of them
+type countingReader struct {
+	r    io.Reader
+	n    int64
+	data []byte
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if c.n+int64(n) <= carveReplayLimit {
+		c.data = append(c.data, b[:n]...)
+	}
+	c.n += int64(n)
+	return n, err
+}
+
+// replayReader returns the replay data before reading from r, so Carve can
+// search data again without stacking up readers
+type replayReader struct {
+	replay []byte
+	r      io.Reader
+}
+
+func (rr *replayReader) Read(b []byte) (int, error) {
+	if len(rr.replay) > 0 {
+		n := copy(b, rr.replay)
+		rr.replay = rr.replay[n:]
+		return n, nil
+	}
+	return rr.r.Read(b)
+}
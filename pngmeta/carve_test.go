@@ -0,0 +1,43 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package pngmeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Many signatures that do not start a PNG must neither hide the one that does
+// nor slow down scanning.
+func TestCarveFalseSignatures(t *testing.T) {
+	var data []byte
+	for range 10000 {
+		data = append(data, PNGMagic...)
+		data = append(data, "\xff\xff\xff\xffJUNK"...)
+	}
+	// A false signature right before the real one, which is read while
+	// parsing the false one.
+	data = append(data, PNGMagic...)
+	want := int64(len(data))
+	data = append(data, testImage(t)...)
+
+	var errs int
+	var found []int64
+	for c := range Carve(bytes.NewReader(data), LoadOptions{}) {
+		if c.Err != nil {
+			errs++
+			continue
+		}
+		found = append(found, c.Offset)
+		if got := c.PNG.Structure(); got != "IHDRtEXtIDATIDATIEND" {
+			t.Errorf("PNG at offset %d: got structure %s", c.Offset, got)
+		}
+	}
+	if len(found) != 1 || found[0] != want {
+		t.Errorf("got PNGs at offsets %v, want %d", found, want)
+	}
+	if errs != 10001 {
+		t.Errorf("got %d PNGs that could not be parsed, want 10001", errs)
+	}
+}
@@ -0,0 +1,161 @@
+// ComfyUI workflow metadata.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Keywords of the text chunks in which ComfyUI stores the executed prompt
+// (the node graph in API format) and the workflow (the graph as shown in the
+// editor).
+const (
+	ComfyPromptKeyword   = "prompt"
+	ComfyWorkflowKeyword = "workflow"
+)
+
+// ComfyNode is a node of a ComfyUI graph
+type ComfyNode struct {
+	ID string
+	// ClassType is the type of the node, e.g. CheckpointLoaderSimple.
+	ClassType string
+	// Inputs are the literal input values of the node, sorted by name. Inputs
+	// connected to other nodes are left out. Values other than strings,
+	// numbers and booleans are given as JSON. In a workflow, the values are
+	// the widget values, which have no names; they are all named
+	// widgets_values, in order.
+	Inputs []ComfyInput
+}
+
+// ComfyInput is an input value of a ComfyNode
+type ComfyInput struct {
+	Name  string
+	Value string
+}
+
+// IsComfy reports whether c is a text chunk that may hold a ComfyUI prompt or
+// workflow.
+func (c *Chunk) IsComfy() bool {
+	if !IsTextChunk(c.Type) {
+		return false
+	}
+	k := c.Keyword()
+	return k == ComfyPromptKeyword || k == ComfyWorkflowKeyword
+}
+
+// ComfyNodes parses the ComfyUI prompt or workflow in a text chunk and returns
+// its nodes, ordered by ID.
+func (c *Chunk) ComfyNodes() ([]ComfyNode, error) {
+	if !c.IsComfy() {
+		return nil, fmt.Errorf("%s chunk does not contain a ComfyUI graph", c.Type)
+	}
+	text, err := c.TextValue()
+	if err != nil {
+		return nil, err
+	}
+	var nodes []ComfyNode
+	if c.Keyword() == ComfyWorkflowKeyword {
+		nodes, err = parseComfyWorkflow(text)
+	} else {
+		nodes, err = parseComfyPrompt(text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid ComfyUI %s: %w", c.Keyword(), err)
+	}
+	slices.SortStableFunc(nodes, func(a, b ComfyNode) int {
+		ai, aerr := strconv.Atoi(a.ID)
+		bi, berr := strconv.Atoi(b.ID)
+		if aerr == nil && berr == nil {
+			return ai - bi
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return nodes, nil
+}
+
+// parseComfyPrompt parses a prompt in API format:
+//
+//	{"4": {"class_type": "CheckpointLoaderSimple",
+//	       "inputs": {"ckpt_name": "sd_xl_base_1.0.safetensors"}}, ...}
+func parseComfyPrompt(data []byte) ([]ComfyNode, error) {
+	var prompt map[string]struct {
+		ClassType string                     `json:"class_type"`
+		Inputs    map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal(data, &prompt); err != nil {
+		return nil, err
+	}
+	var nodes []ComfyNode
+	for id, n := range prompt {
+		node := ComfyNode{ID: id, ClassType: n.ClassType}
+		for name, raw := range n.Inputs {
+			var link []any
+			// Connections are given as [node ID, output index].
+			if json.Unmarshal(raw, &link) == nil && len(link) == 2 {
+				if _, ok := link[0].(string); ok {
+					continue
+				}
+			}
+			node.Inputs = append(node.Inputs, ComfyInput{name, comfyValue(raw)})
+		}
+		slices.SortFunc(node.Inputs, func(a, b ComfyInput) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// parseComfyWorkflow parses a workflow as saved by the editor:
+//
+//	{"nodes": [{"id": 4, "type": "CheckpointLoaderSimple",
+//	            "widgets_values": ["sd_xl_base_1.0.safetensors"]}, ...], ...}
+func parseComfyWorkflow(data []byte) ([]ComfyNode, error) {
+	var workflow struct {
+		Nodes []struct {
+			ID            json.RawMessage `json:"id"`
+			Type          string          `json:"type"`
+			WidgetsValues json.RawMessage `json:"widgets_values"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return nil, err
+	}
+	var nodes []ComfyNode
+	for _, n := range workflow.Nodes {
+		node := ComfyNode{ID: comfyValue(n.ID), ClassType: n.Type}
+		var values []json.RawMessage
+		// Some nodes store their widget values as an object instead.
+		if json.Unmarshal(n.WidgetsValues, &values) != nil && len(n.WidgetsValues) > 0 {
+			values = []json.RawMessage{n.WidgetsValues}
+		}
+		for _, v := range values {
+			node.Inputs = append(node.Inputs, ComfyInput{"widgets_values", comfyValue(v)})
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// comfyValue returns a JSON value as text: strings without quotes, everything
+// else as compact JSON.
+func comfyValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, raw) != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
@@ -0,0 +1,70 @@
+// Streaming CRC32 verification.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ChecksumMismatch describes a chunk whose stored CRC32 checksum does not
+// match its contents
+type ChecksumMismatch struct {
+	Offset   int64 // Offset of the chunk in the file
+	Type     string
+	Stored   uint32
+	Computed uint32
+}
+
+func (m ChecksumMismatch) String() string {
+	return fmt.Sprintf("%s at offset %d: CRC32 mismatch - stored %08x, computed %08x",
+		m.Type, m.Offset, m.Stored, m.Computed)
+}
+
+// VerifyChecksums reads a PNG from r and checks the CRC32 checksum of every
+// chunk. Unlike Load, it never keeps chunk data in memory: the data is hashed
+// while it is read and then discarded, so memory use does not depend on the
+// size of the file.
+func VerifyChecksums(r io.Reader) ([]ChecksumMismatch, error) {
+	var mismatches []ChecksumMismatch
+	header := make([]byte, len(PNGMagic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header) != PNGMagic {
+		return nil, fmt.Errorf("wrong PNG header. Got %x - Expected %x",
+			header, PNGMagic)
+	}
+	offset := int64(len(PNGMagic))
+	buf := make([]byte, 8)
+	for {
+		// Length and type
+		if err := fillRead(&buf, r); err != nil {
+			if err == io.EOF {
+				return mismatches, nil
+			}
+			return mismatches, err
+		}
+		length := int64(binary.BigEndian.Uint32(buf[0:4]))
+		t := string(buf[4:8])
+		crc := crc32.NewIEEE()
+		crc.Write(buf[4:8])
+		if _, err := io.CopyN(crc, r, length); err != nil {
+			return mismatches, fmt.Errorf("%s at offset %d: %w", t, offset, unexpectedEOF(err))
+		}
+		stored := make([]byte, 4)
+		if err := fillRead(&stored, r); err != nil {
+			return mismatches, fmt.Errorf("%s at offset %d: %w", t, offset, unexpectedEOF(err))
+		}
+		if s := binary.BigEndian.Uint32(stored); s != crc.Sum32() {
+			mismatches = append(mismatches, ChecksumMismatch{offset, t, s, crc.Sum32()})
+		}
+		offset += 12 + length
+	}
+}
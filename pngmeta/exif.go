@@ -0,0 +1,413 @@
+// EXIF (eXIf chunk) parsing.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// EXIF data is a TIFF structure: a header giving the byte order and the
+// offset of the first IFD (image file directory), followed by a chain of
+// IFDs. Every IFD is a list of tagged entries and the offset of the next IFD.
+// See https://www.cipa.jp/std/documents/e/DC-X008-Translation-2019-E.pdf
+
+// TIFF field types and their sizes in bytes
+var tiffTypeSize = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+// EXIF tags used for locating the thumbnail
+const (
+	tagJPEGInterchangeFormat       = 0x0201
+	tagJPEGInterchangeFormatLength = 0x0202
+)
+
+// tiff is a parsed TIFF header along with the complete data, since all
+// offsets are relative to the start of the header.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+	first uint32 // offset of IFD0
+}
+
+// ifdEntry is a single tagged field of an IFD, with its value already
+// resolved (whether stored inline or at an offset).
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func parseTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("EXIF data too short: %d bytes", len(data))
+	}
+	t := &tiff{data: data}
+	switch string(data[0:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid TIFF header in EXIF data: %x", data[0:4])
+	}
+	t.first = t.order.Uint32(data[4:8])
+	return t, nil
+}
+
+// ifd reads the IFD at the given offset and returns its entries and the
+// offset of the next IFD (0 if there is none).
+func (t *tiff) ifd(offset uint32) ([]ifdEntry, uint32, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, 0, fmt.Errorf("IFD offset %d out of bounds", offset)
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	pos := int(offset) + 2
+	if pos+n*12+4 > len(t.data) {
+		return nil, 0, fmt.Errorf("IFD at offset %d with %d entries out of bounds", offset, n)
+	}
+	entries := make([]ifdEntry, 0, n)
+	for i := 0; i < n; i++ {
+		raw := t.data[pos : pos+12]
+		pos += 12
+		e := ifdEntry{
+			tag:   t.order.Uint16(raw[0:2]),
+			typ:   t.order.Uint16(raw[2:4]),
+			count: t.order.Uint32(raw[4:8]),
+		}
+		size, ok := tiffTypeSize[e.typ]
+		if !ok {
+			// Unknown types are skipped, as the spec demands.
+			continue
+		}
+		total := uint64(size) * uint64(e.count)
+		if total <= 4 {
+			e.value = raw[8 : 8+total]
+		} else {
+			off := uint64(t.order.Uint32(raw[8:12]))
+			if off+total > uint64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[off : off+total]
+		}
+		entries = append(entries, e)
+	}
+	next := t.order.Uint32(t.data[pos:])
+	return entries, next, nil
+}
+
+// uint returns the first value of a SHORT or LONG entry
+func (t *tiff) uint(e ifdEntry) (uint32, bool) {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value)), true
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+// exif returns the parsed TIFF structure of the eXIf chunk, if there is one.
+func (png PNG) exif() (*tiff, error) {
+	chunks := png.GetChunksByType("eXIf")
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no eXIf chunk")
+	}
+	return parseTIFF(chunks[0].Data)
+}
+
+// ExifThumbnail returns the JPEG thumbnail embedded in the EXIF data of the
+// eXIf chunk, as referenced by the JPEGInterchangeFormat and
+// JPEGInterchangeFormatLength tags of IFD1. It returns ok=false if there is no
+// such thumbnail, or if the referenced data is not a JPEG image.
+func (png PNG) ExifThumbnail() ([]byte, bool) {
+	t, err := png.exif()
+	if err != nil {
+		return nil, false
+	}
+	_, next, err := t.ifd(t.first)
+	if err != nil || next == 0 {
+		return nil, false
+	}
+	ifd1, _, err := t.ifd(next)
+	if err != nil {
+		return nil, false
+	}
+	var offset, length uint32
+	var haveOffset, haveLength bool
+	for _, e := range ifd1 {
+		switch e.tag {
+		case tagJPEGInterchangeFormat:
+			offset, haveOffset = t.uint(e)
+		case tagJPEGInterchangeFormatLength:
+			length, haveLength = t.uint(e)
+		}
+	}
+	if !haveOffset || !haveLength || uint64(offset)+uint64(length) > uint64(len(t.data)) {
+		return nil, false
+	}
+	thumb := t.data[offset : offset+length]
+	// Every JPEG starts with the SOI (start of image) marker.
+	if !bytes.HasPrefix(thumb, []byte{0xff, 0xd8}) {
+		return nil, false
+	}
+	return thumb, true
+}
+
+// EXIF tags pointing to sub-IFDs
+const (
+	tagExifIFD    = 0x8769
+	tagGPSIFD     = 0x8825
+	tagInteropIFD = 0xa005
+)
+
+// exifTagNames are the names of the commonly used tags of IFD0 and the Exif
+// IFD. Other tags are named by their number, e.g. Tag0x9c9b.
+var exifTagNames = map[uint16]string{
+	0x010e: "ImageDescription",
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x011a: "XResolution",
+	0x011b: "YResolution",
+	0x0128: "ResolutionUnit",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013b: "Artist",
+	0x8298: "Copyright",
+	0x829a: "ExposureTime",
+	0x829d: "FNumber",
+	0x8822: "ExposureProgram",
+	0x8827: "ISOSpeedRatings",
+	0x9000: "ExifVersion",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x9010: "OffsetTime",
+	0x9011: "OffsetTimeOriginal",
+	0x9201: "ShutterSpeedValue",
+	0x9202: "ApertureValue",
+	0x9204: "ExposureBiasValue",
+	0x9207: "MeteringMode",
+	0x9209: "Flash",
+	0x920a: "FocalLength",
+	0x927c: "MakerNote",
+	0x9286: "UserComment",
+	0xa001: "ColorSpace",
+	0xa002: "PixelXDimension",
+	0xa003: "PixelYDimension",
+	0xa420: "ImageUniqueID",
+	0xa430: "CameraOwnerName",
+	0xa431: "BodySerialNumber",
+	0xa432: "LensSpecification",
+	0xa433: "LensMake",
+	0xa434: "LensModel",
+	0xa435: "LensSerialNumber",
+}
+
+// gpsTagNames are the names of the tags of the GPS IFD
+var gpsTagNames = map[uint16]string{
+	0x00: "GPSVersionID",
+	0x01: "GPSLatitudeRef",
+	0x02: "GPSLatitude",
+	0x03: "GPSLongitudeRef",
+	0x04: "GPSLongitude",
+	0x05: "GPSAltitudeRef",
+	0x06: "GPSAltitude",
+	0x07: "GPSTimeStamp",
+	0x12: "GPSMapDatum",
+	0x1d: "GPSDateStamp",
+}
+
+// ExifField is a decoded field of EXIF data
+type ExifField struct {
+	// IFD is the directory the field is from: IFD0, Exif or GPS.
+	IFD string
+	Tag uint16
+	// Name is the name of the tag as used in the EXIF specification, or
+	// Tag0x followed by its number in hex for tags not known by name.
+	Name string
+	// Value is the value in text form. ASCII strings are returned as they
+	// are, numbers in decimal (several separated by spaces), rationals as
+	// n/d, and binary data as hex (or just its size, if it is long).
+	Value string
+}
+
+// ExifFields decodes the fields of IFD0 and of the Exif and GPS IFDs it
+// refers to in an eXIf chunk. The pointers to other IFDs are not returned as
+// fields. If the GPS IFD holds a complete position, it is also returned as a
+// GPSPosition field in decimal degrees, like "48.858222, 2.294500".
+func (c *Chunk) ExifFields() ([]ExifField, error) {
+	if c.Type != "eXIf" {
+		return nil, fmt.Errorf("%s chunk does not contain EXIF data", c.Type)
+	}
+	t, err := parseTIFF(c.Data)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, _, err := t.ifd(t.first)
+	if err != nil {
+		return nil, err
+	}
+	var fields []ExifField
+	var exifIFD, gpsIFD []ifdEntry
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagExifIFD:
+			if off, ok := t.uint(e); ok {
+				exifIFD, _, _ = t.ifd(off)
+			}
+		case tagGPSIFD:
+			if off, ok := t.uint(e); ok {
+				gpsIFD, _, _ = t.ifd(off)
+			}
+		case tagJPEGInterchangeFormat, tagJPEGInterchangeFormatLength:
+		default:
+			fields = append(fields, t.field("IFD0", e, exifTagNames))
+		}
+	}
+	for _, e := range exifIFD {
+		if e.tag != tagInteropIFD {
+			fields = append(fields, t.field("Exif", e, exifTagNames))
+		}
+	}
+	for _, e := range gpsIFD {
+		fields = append(fields, t.field("GPS", e, gpsTagNames))
+	}
+	if pos, ok := t.gpsPosition(gpsIFD); ok {
+		fields = append(fields, ExifField{"GPS", 0, "GPSPosition", pos})
+	}
+	return fields, nil
+}
+
+// field decodes an entry, naming it from names
+func (t *tiff) field(ifd string, e ifdEntry, names map[uint16]string) ExifField {
+	name, ok := names[e.tag]
+	if !ok {
+		name = fmt.Sprintf("Tag%#04x", e.tag)
+	}
+	return ExifField{ifd, e.tag, name, t.format(e)}
+}
+
+// format returns the value of an entry in text form, see ExifField.Value
+func (t *tiff) format(e ifdEntry) string {
+	switch e.typ {
+	case 2: // ASCII
+		return strings.TrimRight(string(e.value), "\x00")
+	case 1, 7: // BYTE, UNDEFINED
+		v := e.value
+		if e.tag == 0x9286 && len(v) >= 8 {
+			// UserComment starts with an 8 byte character code.
+			v = v[8:]
+		}
+		v = bytes.TrimRight(v, "\x00 ")
+		if isPrintable(v) {
+			return string(v)
+		}
+		if len(v) > 16 {
+			return fmt.Sprintf("(%d bytes)", len(v))
+		}
+		return fmt.Sprintf("% x", v)
+	}
+	var vals []string
+	for i := uint32(0); i < e.count; i++ {
+		switch e.typ {
+		case 3: // SHORT
+			vals = append(vals, fmt.Sprint(t.order.Uint16(e.value[2*i:])))
+		case 4: // LONG
+			vals = append(vals, fmt.Sprint(t.order.Uint32(e.value[4*i:])))
+		case 9: // SLONG
+			vals = append(vals, fmt.Sprint(int32(t.order.Uint32(e.value[4*i:]))))
+		case 5: // RATIONAL
+			n, d := t.order.Uint32(e.value[8*i:]), t.order.Uint32(e.value[8*i+4:])
+			vals = append(vals, formatRational(int64(n), int64(d)))
+		case 10: // SRATIONAL
+			n, d := int32(t.order.Uint32(e.value[8*i:])), int32(t.order.Uint32(e.value[8*i+4:]))
+			vals = append(vals, formatRational(int64(n), int64(d)))
+		}
+	}
+	return strings.Join(vals, " ")
+}
+
+// formatRational returns n/d, or just n if d is 1
+func formatRational(n, d int64) string {
+	if d == 1 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d/%d", n, d)
+}
+
+// rational returns the i-th value of a RATIONAL entry as a float
+func (t *tiff) rational(e ifdEntry, i int) (float64, bool) {
+	if e.typ != 5 || len(e.value) < 8*(i+1) {
+		return 0, false
+	}
+	n, d := t.order.Uint32(e.value[8*i:]), t.order.Uint32(e.value[8*i+4:])
+	if d == 0 {
+		return 0, false
+	}
+	return float64(n) / float64(d), true
+}
+
+// gpsPosition returns latitude and longitude from the GPS IFD in decimal
+// degrees, negative for south and west.
+func (t *tiff) gpsPosition(gps []ifdEntry) (string, bool) {
+	byTag := make(map[uint16]ifdEntry)
+	for _, e := range gps {
+		byTag[e.tag] = e
+	}
+	coord := func(tag, refTag uint16, negative string) (float64, bool) {
+		e, ok := byTag[tag]
+		if !ok || e.count != 3 {
+			return 0, false
+		}
+		var v float64
+		for i, div := range []float64{1, 60, 3600} {
+			x, ok := t.rational(e, i)
+			if !ok {
+				return 0, false
+			}
+			v += x / div
+		}
+		if ref, ok := byTag[refTag]; ok && strings.HasPrefix(string(ref.value), negative) {
+			v = -v
+		}
+		return v, true
+	}
+	lat, ok := coord(0x02, 0x01, "S")
+	if !ok {
+		return "", false
+	}
+	long, ok := coord(0x04, 0x03, "W")
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%.6f, %.6f", lat, long), true
+}
+
+// isPrintable reports whether data is non-empty printable ASCII
+func isPrintable(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if b < 0x20 || b > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+// Limits on chunk lengths, to read untrusted files safely.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxChunkLen is the largest chunk length the specification allows, 2^31-1.
+const MaxChunkLen = 1<<31 - 1
+
+// ErrChunkTooLarge is returned (wrapped) for chunks whose length exceeds
+// MaxChunkLen, LoadOptions.MaxChunkSize or the size possible for their type.
+var ErrChunkTooLarge = errors.New("chunk too large")
+
+// maxFixedLen is the largest possible length of chunks whose data has a
+// fixed size, or at most a known size.
+var maxFixedLen = map[string]int{
+	"IHDR": 13,
+	"PLTE": 3 * 256,
+	"IEND": 0,
+	"tRNS": 256,
+	"gAMA": 4,
+	"cHRM": 32,
+	"sRGB": 1,
+	"sBIT": 4,
+	"bKGD": 6,
+	"hIST": 2 * 256,
+	"pHYs": 9,
+	"tIME": 7,
+	"oFFs": 9,
+	"sTER": 1,
+	"acTL": 8,
+	"fcTL": 26,
+}
+
+// checkLen checks the length of a chunk before its data is read. maxSize is
+// the limit for data that is kept in memory, 0 for none.
+func (c *Chunk) checkLen(maxSize int, kept bool) error {
+	max := MaxChunkLen
+	if m, ok := maxFixedLen[c.Type]; ok {
+		max = m
+	} else if kept && maxSize > 0 && maxSize < max {
+		max = maxSize
+	}
+	if c.Len > max {
+		return fmt.Errorf("%w: %s at offset %d has %d bytes, the maximum is %d",
+			ErrChunkTooLarge, c.Type, c.Offset, c.Len, max)
+	}
+	return nil
+}
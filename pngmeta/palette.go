@@ -0,0 +1,56 @@
+// Parser for the palette of indexed-color images.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"image/color"
+)
+
+// Palette returns the palette of an image, as stored in the PLTE chunk, with
+// the alpha values of the tRNS chunk for indexed-color images. Entries
+// without an alpha value are opaque. As in the file, the colors are not
+// premultiplied by alpha. It returns ok=false if the image has no (valid)
+// PLTE chunk. Note that truecolor images may have a PLTE chunk, too, as a
+// suggested palette for displays with fewer colors.
+//
+// From https://www.w3.org/TR/png/#11PLTE
+// ```
+// The PLTE chunk contains from 1 to 256 palette entries, each a three-byte
+// series of the form:
+//
+// Red:   1 byte
+// Green: 1 byte
+// Blue:  1 byte
+// ```
+//
+// From https://www.w3.org/TR/png/#11tRNS
+// ```
+// For colour type 3 (indexed-colour), the tRNS chunk contains a series of
+// one-byte alpha values, corresponding to entries in the PLTE chunk.
+// ```
+func (png PNG) Palette() ([]color.NRGBA, bool) {
+	chunks := png.GetChunksByType("PLTE")
+	if len(chunks) == 0 {
+		return nil, false
+	}
+	d := chunks[0].Data
+	if len(d) == 0 || len(d)%3 != 0 || len(d) > 3*256 {
+		return nil, false
+	}
+	var alpha []byte
+	if trns := png.GetChunksByType("tRNS"); png.ColorType == 3 && len(trns) > 0 {
+		alpha = trns[0].Data
+	}
+	palette := make([]color.NRGBA, len(d)/3)
+	for i := range palette {
+		palette[i] = color.NRGBA{d[3*i], d[3*i+1], d[3*i+2], 0xff}
+		if i < len(alpha) {
+			palette[i].A = alpha[i]
+		}
+	}
+	return palette, true
+}
@@ -0,0 +1,33 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package pngmeta
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// The alpha values of tRNS must not change the colors of the palette.
+func TestPaletteNotPremultiplied(t *testing.T) {
+	ihdr := []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 3, 0, 0, 0}
+	png, err := NewPNG([]*Chunk{
+		NewChunk("IHDR", ihdr),
+		NewChunk("PLTE", []byte{0xff, 0x80, 0x00, 0x10, 0x20, 0x30}),
+		NewChunk("tRNS", []byte{0x80}),
+		NewChunk("IDAT", nil),
+		NewChunk("IEND", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := png.Palette()
+	if !ok {
+		t.Fatal("got no palette")
+	}
+	want := []color.NRGBA{{0xff, 0x80, 0x00, 0x80}, {0x10, 0x20, 0x30, 0xff}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got palette %v, want %v", got, want)
+	}
+}
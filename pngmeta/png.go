@@ -0,0 +1,695 @@
+// Simple PNG parser. Can be used to discover and extract text chunks.
+// Minimal error handling, does not play well with malformed chunks. Chunk CRC32
+// checksums are only checked on request, see LoadOptions.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+// Package pngmeta reads, inspects and writes the chunks of PNG images, with a
+// focus on metadata like text chunks. It is the parser behind pngrep.
+package pngmeta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strings"
+)
+
+// From https://www.w3.org/TR/png/#5PNG-file-signature:
+// ```
+// The first eight bytes of a PNG datastream always contain the following
+// (decimal) values:
+//
+// 137 80 78 71 13 10 26 10
+//
+// which are (in hexadecimal):
+//
+// 89 50 4E 47 0D 0A 1A 0A
+//
+// This signature indicates that the remainder of the datastream contains a
+// single PNG image, consisting of a series of chunks beginning with an IHDR
+// chunk and ending with an IEND chunk.
+// ```
+const (
+	PNGMagic   = "\x89\x50\x4E\x47\x0D\x0A\x1A\x0A"
+	iHDRlength = 13
+)
+
+var ct2bd map[int][]int
+
+func init() {
+	ct2bd = make(map[int][]int)
+	ct2bd[0] = []int{1, 2, 4, 8, 16}
+	ct2bd[2] = []int{8, 16}
+	ct2bd[3] = []int{1, 2, 4, 8}
+	ct2bd[4] = ct2bd[2]
+	ct2bd[6] = ct2bd[2]
+}
+
+// colorTypeNames are the names the specification gives the color types
+var colorTypeNames = map[int]string{
+	0: "Greyscale",
+	2: "Truecolor",
+	3: "Indexed-color",
+	4: "Greyscale with alpha",
+	6: "Truecolor with alpha",
+}
+
+// ColorTypeName returns the name of a color type as used in the
+// specification, e.g. "Truecolor with alpha" for 6.
+func ColorTypeName(ct int) string {
+	if name, ok := colorTypeNames[ct]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (%d)", ct)
+}
+
+// PNG represent a PNG file, including metadata and (compressed) image data
+type PNG struct {
+	Width       int
+	Height      int
+	Depth       int
+	ColorType   int
+	Compression int
+	Filter      int
+	Interlace   int
+	Chunks      []*Chunk
+	NumCHunks   int
+	Warnings    []Warning
+	// Signature holds the bytes actually read as the file signature, even if
+	// they did not match the expected one.
+	Signature []byte
+	// Trailing holds any data following the IEND chunk.
+	Trailing []byte
+	// ChecksumMismatches lists the chunks whose CRC32 checksum is wrong, if
+	// LoadOptions.VerifyChecksums is set.
+	ChecksumMismatches []ChecksumMismatch
+
+	collectWarnings bool
+	complete        bool // IEND has been read
+}
+
+// Chunk is a PNG file chunk, including its CRC32 checksum
+type Chunk struct {
+	Len      int
+	Type     string
+	Data     []byte
+	Checksum []byte
+	// Offset is the position of the chunk (its length field) in the file
+	Offset int64
+	// DataSkipped is set if the data was not kept when loading, see
+	// LoadOptions.SkipImageData. Data is nil in that case.
+	DataSkipped bool
+
+	crc uint32 // checksum computed while skipping the data
+}
+
+// Warning is a non-fatal problem found while parsing a PNG
+type Warning struct {
+	Chunk   string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Chunk == "" {
+		return w.Message
+	}
+	return fmt.Sprintf("%s: %s", w.Chunk, w.Message)
+}
+
+// LoadOptions control the behavior of LoadWithOptions
+type LoadOptions struct {
+	// Warnings enables collecting non-fatal problems in PNG.Warnings
+	Warnings bool
+	// Signature is the expected file signature. It defaults to PNGMagic, but
+	// can be set to parse files with a known variant header.
+	Signature string
+	// SkipImageData discards the data of IDAT and fdAT chunks while reading,
+	// so memory use depends on the size of the metadata only. The chunks are
+	// still listed with their type, length and checksum. Such a PNG can be
+	// searched, but not written, and its image data is not available.
+	SkipImageData bool
+	// SeekImageData is like SkipImageData, but if the reader is an
+	// io.Seeker, the image data is skipped by seeking past it instead of
+	// reading it, so it never has to be transferred, e.g. over the network.
+	// The checksums of the skipped chunks cannot be verified then, and are
+	// taken as valid. With VerifyChecksums or Strict, the data is read.
+	SeekImageData bool
+	// VerifyChecksums checks the CRC32 checksum of every chunk and records
+	// the mismatches in PNG.ChecksumMismatches.
+	VerifyChecksums bool
+	// Strict turns violations of the specification into errors: wrong
+	// checksums, missing or misplaced critical chunks, invalid text keywords,
+	// truncated files and data after IEND.
+	Strict bool
+	// Lenient salvages what it can from malformed files instead of failing:
+	// a wrong signature or an invalid IHDR chunk only cause warnings, and all
+	// chunks that could be read are kept.
+	Lenient bool
+	// MaxChunkSize is the largest chunk whose data is kept in memory, to
+	// read untrusted files without running out of memory. Larger chunks are
+	// errors wrapping ErrChunkTooLarge. It defaults to no limit beyond the
+	// MaxChunkLen of the specification. Chunks of a fixed size, like IHDR,
+	// are always limited to the size of their type, no matter this option.
+	MaxChunkSize int
+}
+
+// Load reads from an io.Reader and returns a PNG struct
+func Load(r io.Reader) (PNG, error) {
+	return LoadWithOptions(r, LoadOptions{})
+}
+
+// LoadWithOptions reads from an io.Reader and returns a PNG struct, honoring
+// the supplied options. The reader is consumed strictly sequentially and never
+// needs to implement io.Seeker, so pipes and FIFOs work just like regular
+// files. Parsing stops at the IEND chunk; anything following it is kept in
+// PNG.Trailing.
+func LoadWithOptions(r io.Reader, opts LoadOptions) (PNG, error) {
+	png, _, err := load(r, opts, 0)
+	if err != nil {
+		return png, err
+	}
+	if png.complete {
+		png.Trailing, err = io.ReadAll(r)
+		if err != nil {
+			return png, err
+		}
+		if len(png.Trailing) > 0 {
+			if opts.Strict {
+				return png, fmt.Errorf("%d bytes of trailing data after IEND", len(png.Trailing))
+			}
+			png.warn("", "%d bytes of trailing data after IEND", len(png.Trailing))
+		}
+	}
+	return png, nil
+}
+
+// LoadAll reads a stream of PNG images concatenated back-to-back, until the
+// end of the reader. Data after the last image that does not start with a
+// PNG signature ends up in the Trailing field of the last image.
+func LoadAll(r io.Reader, opts LoadOptions) ([]PNG, error) {
+	magic := opts.Signature
+	if magic == "" {
+		magic = PNGMagic
+	}
+	br := bufio.NewReader(r)
+	var pngs []PNG
+	var offset int64
+	for {
+		png, end, err := load(br, opts, offset)
+		pngs = append(pngs, png)
+		if err != nil || !png.complete {
+			return pngs, err
+		}
+		next, err := br.Peek(len(magic))
+		if len(next) == 0 && err == io.EOF {
+			return pngs, nil
+		}
+		if string(next) != magic {
+			last := &pngs[len(pngs)-1]
+			if last.Trailing, err = io.ReadAll(br); err != nil {
+				return pngs, err
+			}
+			if opts.Strict {
+				return pngs, fmt.Errorf("%d bytes of trailing data after IEND", len(last.Trailing))
+			}
+			last.warn("", "%d bytes of trailing data after IEND", len(last.Trailing))
+			return pngs, nil
+		}
+		offset = end
+	}
+}
+
+// load reads one PNG, up to and including its IEND chunk. offset is the
+// position of the PNG in the file, and the position after it is returned.
+func load(r io.Reader, opts LoadOptions, offset int64) (PNG, int64, error) {
+	var png PNG
+	png.collectWarnings = opts.Warnings
+	magic := opts.Signature
+	if magic == "" {
+		magic = PNGMagic
+	}
+	// Read first 8 bytes == PNG header.
+	header := make([]byte, len(magic))
+	n, err := io.ReadFull(r, header)
+	png.Signature = header[:n]
+	if err != nil {
+		return png, offset, err
+	}
+	if string(header) != magic {
+		if !opts.Lenient {
+			return png, offset, fmt.Errorf("wrong PNG header. Got %x - Expected %x",
+				header, magic)
+		}
+		png.warn("", "wrong PNG header %x", header)
+	}
+
+	offset += int64(len(magic))
+	var seeker io.Seeker
+	if s, ok := r.(io.Seeker); ok && opts.SeekImageData && !opts.VerifyChecksums && !opts.Strict {
+		seeker = s
+	}
+	for err == nil && !png.complete {
+		c := Chunk{Offset: offset}
+		err = (&c).fill(r, opts.SkipImageData || opts.SeekImageData, seeker, opts.MaxChunkSize)
+		if errors.Is(err, ErrChunkTooLarge) {
+			// The rest of the file can not be trusted to be PNG chunks.
+			if !opts.Lenient || len(png.Chunks) == 0 {
+				return png, offset, err
+			}
+			png.warn(c.Type, "%s", err)
+			err = nil
+			break
+		}
+		offset += 12 + int64(c.Len)
+		// Drop the last empty chunk.
+		if c.Type != "" {
+			png.Chunks = append(png.Chunks, &c)
+		}
+		if err == nil {
+			if opts.VerifyChecksums && !c.ValidChecksum() {
+				png.ChecksumMismatches = append(png.ChecksumMismatches, ChecksumMismatch{
+					Offset:   c.Offset,
+					Type:     c.Type,
+					Stored:   binary.BigEndian.Uint32(c.Checksum),
+					Computed: c.ComputeChecksum(),
+				})
+			}
+			png.checkChunk(&c)
+			png.complete = c.Type == "IEND"
+		}
+	}
+	if err != nil && err != io.EOF {
+		if opts.Strict {
+			return png, offset, fmt.Errorf("truncated chunk at end of file: %w", err)
+		}
+		png.warn("", "truncated chunk at end of file: %s", err)
+	} else if !png.complete {
+		if opts.Strict {
+			return png, offset, fmt.Errorf("missing IEND chunk")
+		}
+		png.warn("", "missing IEND chunk")
+	}
+
+	if err := (&png).Fill(); err != nil {
+		if !opts.Lenient || len(png.Chunks) == 0 {
+			return png, offset, err
+		}
+		png.warn("IHDR", "%s", err)
+		png.NumCHunks = len(png.Chunks)
+	}
+	if opts.Strict {
+		if err := png.validate(); err != nil {
+			return png, offset, err
+		}
+	}
+	return png, offset, nil
+}
+
+// checkChunk records warnings for spec violations in a fully read chunk that
+// do not keep us from using the chunk.
+func (png *PNG) checkChunk(c *Chunk) {
+	if !png.collectWarnings {
+		return
+	}
+	if !c.ValidChecksum() {
+		png.warn(c.Type, "CRC32 mismatch - stored %x, computed %08x",
+			c.Checksum, c.ComputeChecksum())
+	}
+	// The third letter of a chunk type is reserved and must be uppercase.
+	if len(c.Type) == 4 && c.Type[2]&0x20 != 0 {
+		png.warn(c.Type, "reserved bit set in chunk type")
+	}
+	if IsTextChunk(c.Type) {
+		if err := ValidKeyword(c.Keyword()); err != nil {
+			png.warn(c.Type, "%s", err)
+		}
+	}
+	n := len(png.Chunks)
+	if n < 2 {
+		return
+	}
+	prev := png.Chunks[n-2]
+	if c.Type == "IDAT" && prev.Type != "IDAT" {
+		for _, o := range png.Chunks[:n-2] {
+			if o.Type == "IDAT" {
+				png.warn(c.Type, "IDAT chunks are not consecutive")
+				break
+			}
+		}
+	}
+}
+
+// warn records a non-fatal problem if warnings are being collected.
+func (png *PNG) warn(chunk, format string, args ...any) {
+	if !png.collectWarnings {
+		return
+	}
+	png.Warnings = append(png.Warnings, Warning{
+		Chunk:   chunk,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ComputeChecksum calculates the CRC32 of the chunk type and data. For chunks
+// whose data was skipped, it returns the checksum computed while reading.
+func (c *Chunk) ComputeChecksum() uint32 {
+	if c.DataSkipped {
+		return c.crc
+	}
+	crc := crc32.NewIEEE()
+	io.WriteString(crc, c.Type)
+	crc.Write(c.Data)
+	return crc.Sum32()
+}
+
+// ValidChecksum reports whether the stored checksum matches the chunk contents
+func (c *Chunk) ValidChecksum() bool {
+	return len(c.Checksum) == 4 &&
+		binary.BigEndian.Uint32(c.Checksum) == c.ComputeChecksum()
+}
+
+// Truncated reports whether the chunk was cut off, as the last chunk of a
+// truncated file can be: it lacks some of its data or its checksum. Chunks
+// whose data was skipped when loading are not truncated.
+func (c *Chunk) Truncated() bool {
+	return len(c.Checksum) != 4 || (!c.DataSkipped && len(c.Data) != c.Len)
+}
+
+// Fill will read bytes from the reader and fill in the chunk
+func (c *Chunk) Fill(r io.Reader) error {
+	return c.fill(r, false, nil, 0)
+}
+
+// growThreshold is the chunk length above which the data buffer grows as the
+// data is read, instead of being allocated up front
+const growThreshold = 1 << 20
+
+// isImageData reports whether chunks of type t hold image data
+func isImageData(t string) bool {
+	return t == "IDAT" || t == "fdAT"
+}
+
+// fill reads the chunk like Fill. With skipImageData, the data of image data
+// chunks is only hashed, not kept.
+func (c *Chunk) fill(r io.Reader, skipImageData bool, seeker io.Seeker, maxSize int) error {
+	var err error
+
+	// Length of the chunk, 4 bytes. Running out of data here is the regular
+	// end of the file, so io.EOF is passed on as-is.
+	buf := make([]byte, 4)
+	err = fillRead(&buf, r)
+	if err != nil {
+		return err
+	}
+	c.Len = int(binary.BigEndian.Uint32(buf))
+
+	// Type, 4 ASCII bytes
+	buf = make([]byte, 4)
+	err = fillRead(&buf, r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	c.Type = string(buf)
+	skip := skipImageData && isImageData(c.Type)
+	if err := c.checkLen(maxSize, !skip); err != nil {
+		return err
+	}
+
+	// Data
+	seek := false
+	if skip && seeker != nil {
+		if _, err := seeker.Seek(int64(c.Len), io.SeekCurrent); err != nil {
+			return unexpectedEOF(err)
+		}
+		c.DataSkipped = true
+		seek = true
+	} else if skip {
+		crc := crc32.NewIEEE()
+		io.WriteString(crc, c.Type)
+		if _, err := io.CopyN(crc, r, int64(c.Len)); err != nil {
+			return unexpectedEOF(err)
+		}
+		c.DataSkipped = true
+		c.crc = crc.Sum32()
+	} else {
+		// We use a separate buffer for this data since it's used wholesale in
+		// our own data structure, instead of being copy-converted.
+		if c.Len > growThreshold {
+			// Only allocate what is actually there, so a bogus length in a
+			// small file does not allocate gigabytes.
+			var b bytes.Buffer
+			n, err := io.CopyN(&b, r, int64(c.Len))
+			if err != nil {
+				return fmt.Errorf("short read - expected %d, got %d", c.Len, n)
+			}
+			c.Data = b.Bytes()
+		} else {
+			tmp := make([]byte, c.Len)
+			err = fillRead(&tmp, r)
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			c.Data = tmp
+		}
+	}
+
+	// CRC32
+	buf = make([]byte, 4)
+	err = fillRead(&buf, r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	c.Checksum = buf
+	if seek {
+		// Nothing to check the stored checksum against.
+		c.crc = binary.BigEndian.Uint32(buf)
+	}
+
+	return nil
+}
+
+// IHDR Parsing
+// Inspired by/lifted from https://golang.org/src/image/png/reader.go
+func (png *PNG) parseIHDR(iHDR *Chunk) error {
+	if len(iHDR.Data) != iHDRlength {
+		return fmt.Errorf("invalid IHDR length: got %d - expected %d",
+			len(iHDR.Data), iHDRlength)
+	}
+
+	// https://www.w3.org/TR/png/#11IHDR
+	// Width:              4 bytes (big endian)
+	// Height:             4 bytes (big endian)
+	// Bit depth:          1 byte
+	// Color type:         1 byte
+	// Compression method: 1 byte
+	// Filter method:      1 byte
+	// Interlace method:   1 byte
+
+	tmp := iHDR.Data
+
+	// From https://www.w3.org/TR/png/#11IHDR
+	// ```
+	// Width and height give the image dimensions in pixels. They are PNG
+	// four-byte unsigned integers. Zero is an invalid value.
+	// ```
+	// and from https://www.w3.org/TR/png/#dfn-png-four-byte-unsigned-integer:
+	// ```
+	// a four-byte unsigned integer limited to the range 0 to 231-1.
+	// NOTE
+	// The restriction is imposed in order to accommodate languages that have
+	// difficulty with unsigned four-byte values.
+	// ``
+	png.Width = int(binary.BigEndian.Uint32(tmp[0:4]))
+	if png.Width == 0 || png.Width > 2<<30 {
+		return fmt.Errorf("invalid width in iHDR expected 0 < w < 2^31, got: %d", png.Width)
+	}
+
+	png.Height = int(binary.BigEndian.Uint32(tmp[4:8]))
+	if png.Height == 0 || png.Height > 2<<30 {
+		return fmt.Errorf("invalid height in iHDR expected 0 < h < 2^31, got: %d", png.Height)
+	}
+
+	// From https://www.w3.org/TR/png/#11IHDR:
+	// ```
+	// Bit depth is a single-byte integer giving the number of bits per sample
+	// or per palette index (not per pixel). Valid values are 1, 2, 4, 8, and
+	// 16, although not all values are allowed for all colour types. See 6.1
+	// Colour types and values.
+	//
+	// Colour type is a single-byte integer.
+	//
+	// Bit depth restrictions for each colour type are imposed to simplify
+	// implementations and to prohibit combinations that do not compress well.
+	// The allowed combinations are defined in Table 13.
+	//
+	// Table 13 Allowed combinations of colour type and bit depth (abridged)
+	//
+	// PNG image type     Colour Allowed
+	// type               type   bit depths
+	// Greyscale	      0	     1,2,4,8,16
+	// Truecolour	      2	     8,16
+	// Indexed            3	     1,2,4,8
+	// Greyscale w/alpha  4      8,16
+	// Truecolour w/alpha 6      8,16
+	// ```
+	png.Depth = int(tmp[8])
+	png.ColorType = int(tmp[9])
+	allowedct, ok := ct2bd[png.ColorType]
+	if !ok {
+		return fmt.Errorf("image with invalid color type - expected one of [0,2,3,4,6], got %d", png.ColorType)
+	}
+	if !slices.Contains(allowedct, png.Depth) {
+		return fmt.Errorf("image with color type %d and wrong depth - expected one of %v, got %d", png.ColorType, allowedct, png.Depth)
+	}
+
+	// From https://www.w3.org/TR/png/#11IHDR
+	// ```
+	// Compression method is a single-byte integer that indicates the method
+	// used to compress the image data. Only compression method 0 (deflate
+	// compression with a sliding window of at most 32768 bytes) is defined in
+	// this specification. All conforming PNG images shall be compressed with
+	// this scheme.
+	// ```
+	if int(tmp[10]) != 0 {
+		return fmt.Errorf("invalid compression method - expected 0 - got %x", tmp[10])
+	}
+	png.Compression = int(tmp[10])
+
+	// From https://www.w3.org/TR/png/#11IHDR
+	// ```
+	// Filter method is a single-byte integer that indicates the preprocessing
+	// method applied to the image data before compression. Only filter method
+	// 0 (adaptive filtering with five basic filter types) is defined in this
+	// specification.
+	// ```
+	if int(tmp[11]) != 0 {
+		return fmt.Errorf("invalid filter method - expected 0 - got %x", tmp[11])
+	}
+	png.Filter = int(tmp[11])
+
+	// From https://www.w3.org/TR/png/#11IHDR
+	// ```
+	// Interlace method is a single-byte integer that indicates the
+	// transmission order of the image data. Two values are defined in this
+	// specification: 0 (no interlace) or 1 (Adam7 interlace).
+	// ```
+	if int(tmp[12]) != 0 && int(tmp[12]) != 1 {
+		return fmt.Errorf("invalid interlace method - expected 0 or 1 - got %x", tmp[12])
+	}
+	png.Interlace = int(tmp[12])
+
+	return nil
+}
+
+// Fill populates the PNG header fields and the number of chunks
+func (png *PNG) Fill() error {
+	if len(png.Chunks) == 0 {
+		return fmt.Errorf("no chunks found")
+	}
+	if err := png.parseIHDR(png.Chunks[0]); err != nil {
+		return err
+	}
+	png.NumCHunks = len(png.Chunks)
+	return nil
+}
+
+// GetChunksByType returns all chunks of the given type, in file order
+func (png PNG) GetChunksByType(t string) []*Chunk {
+	var chunks []*Chunk
+	for _, c := range png.Chunks {
+		if c.Type == t {
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks
+}
+
+// Structure returns the types of all chunks concatenated in file order, e.g.
+// "IHDRsRGBtEXtIDATIEND". Encoders tend to leave characteristic chunk
+// layouts, so this can be useful for telling which tool produced a file.
+func (png PNG) Structure() string {
+	var sb strings.Builder
+	for _, c := range png.Chunks {
+		sb.WriteString(c.Type)
+	}
+	return sb.String()
+}
+
+// Keyword returns the keyword of a text chunk (tEXt, zTXt or iTXt), which is
+// everything before the first NUL byte. For other chunk types, it returns an
+// empty string.
+func (c *Chunk) Keyword() string {
+	if !IsTextChunk(c.Type) {
+		return ""
+	}
+	k, _, _ := bytes.Cut(c.Data, []byte{0})
+	return string(k)
+}
+
+// IsTextChunk reports whether t is one of the text chunk types tEXt, zTXt and
+// iTXt.
+func IsTextChunk(t string) bool {
+	return t == "tEXt" || t == "zTXt" || t == "iTXt"
+}
+
+// GetTextChunks examines the chunks of a PNG image and returns the ones of type tEXt
+func (png PNG) GetTextChunks() []string {
+	var chunks []string
+	for _, c := range png.Chunks {
+		if c.Type == "tEXt" {
+			chunks = append(chunks, string(c.Data))
+		}
+	}
+	return chunks
+}
+
+// ImageDataHash returns the SHA-256 hash of the concatenated data of all IDAT
+// chunks. Metadata chunks do not influence the result.
+func (png PNG) ImageDataHash() []byte {
+	h := sha256.New()
+	for _, c := range png.Chunks {
+		if c.Type == "IDAT" {
+			h.Write(c.Data)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// DecompressImageData returns the inflated contents of all IDAT chunks, i.e.
+// the filtered scanlines of the image. If the stream is corrupt, the data
+// decompressed up to that point is returned along with the error.
+func (png PNG) DecompressImageData() ([]byte, error) {
+	var compressed []byte
+	for _, c := range png.GetChunksByType("IDAT") {
+		compressed = append(compressed, c.Data...)
+	}
+	return inflate(compressed)
+}
+
+func fillRead(buf *[]byte, r io.Reader) error {
+	expected := len(*buf)
+	n, err := io.ReadFull(r, *buf)
+	if n == 0 && err == io.EOF {
+		return err
+	}
+	if n != expected {
+		return fmt.Errorf("short read - expected %d, got %d", expected, n)
+	}
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
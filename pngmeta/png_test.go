@@ -0,0 +1,106 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package pngmeta
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// testImage returns a small PNG with a text chunk, two IDAT chunks and some
+// data after IEND.
+func testImage(t testing.TB) []byte {
+	t.Helper()
+	ihdr := []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 2, 0, 0, 0}
+	png, err := NewPNG([]*Chunk{
+		NewChunk("IHDR", ihdr),
+		NewChunk("tEXt", []byte("Comment\x00hello")),
+		NewChunk("IDAT", bytes.Repeat([]byte{1}, 100)),
+		NewChunk("IDAT", bytes.Repeat([]byte{2}, 100)),
+		NewChunk("IEND", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Trailing = []byte("trailer")
+	var buf bytes.Buffer
+	if _, err := png.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sequentialReader hides any methods of the wrapped reader but Read, like
+// io.Seeker, as reading from a pipe or FIFO does.
+type sequentialReader struct {
+	r io.Reader
+}
+
+func (s sequentialReader) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func TestLoadSequential(t *testing.T) {
+	data := testImage(t)
+	for _, skip := range []bool{false, true} {
+		r := sequentialReader{bytes.NewReader(data)}
+		if _, ok := io.Reader(r).(io.Seeker); ok {
+			t.Fatal("sequentialReader implements io.Seeker")
+		}
+		png, err := LoadWithOptions(r, LoadOptions{SkipImageData: skip})
+		if err != nil {
+			t.Fatalf("SkipImageData=%v: %s", skip, err)
+		}
+		if got := png.Structure(); got != "IHDRtEXtIDATIDATIEND" {
+			t.Errorf("SkipImageData=%v: got structure %s", skip, got)
+		}
+		if got := png.GetTextChunks(); len(got) != 1 || got[0] != "Comment\x00hello" {
+			t.Errorf("SkipImageData=%v: got text chunks %q", skip, got)
+		}
+		if string(png.Trailing) != "trailer" {
+			t.Errorf("SkipImageData=%v: got trailing data %q", skip, png.Trailing)
+		}
+		for _, c := range png.GetChunksByType("IDAT") {
+			if c.DataSkipped != skip {
+				t.Errorf("SkipImageData=%v: IDAT at offset %d has DataSkipped=%v", skip, c.Offset, c.DataSkipped)
+			}
+			if skip && c.Data != nil {
+				t.Errorf("IDAT at offset %d: data was kept", c.Offset)
+			}
+			if !skip && len(c.Data) != 100 {
+				t.Errorf("IDAT at offset %d: got %d bytes of data, want 100", c.Offset, len(c.Data))
+			}
+			if !c.ValidChecksum() {
+				t.Errorf("SkipImageData=%v: IDAT at offset %d: checksum does not match", skip, c.Offset)
+			}
+		}
+	}
+}
+
+func benchmarkLoad(b *testing.B, opts LoadOptions) {
+	images, err := SyntheticImages()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, img := range images {
+		b.Run(img.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(img.Data)))
+			b.ReportAllocs()
+			for range b.N {
+				if _, err := LoadWithOptions(bytes.NewReader(img.Data), opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	benchmarkLoad(b, LoadOptions{})
+}
+
+func BenchmarkLoadSkipImageData(b *testing.B) {
+	benchmarkLoad(b, LoadOptions{SkipImageData: true})
+}
@@ -0,0 +1,116 @@
+// Stable Diffusion generation parameters.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"strings"
+)
+
+// SDKeyword is the keyword of the tEXt chunk in which the AUTOMATIC1111
+// Stable Diffusion web UI, and many tools compatible with it, store the
+// generation parameters.
+const SDKeyword = "parameters"
+
+// SDParameters are the parsed generation parameters of an AI-generated image.
+// The text is made up of the prompt, an optional line starting with
+// "Negative prompt: " and a final line of comma-separated settings:
+//
+//	a cat in a hat
+//	Negative prompt: blurry
+//	Steps: 20, Sampler: Euler a, CFG scale: 7, Seed: 12345, Model hash: abc123
+type SDParameters struct {
+	Prompt         string
+	NegativePrompt string
+	// Settings are the settings from the last line, in order, e.g.
+	// {"Steps", "20"}. Quoted values are unquoted.
+	Settings []SDSetting
+}
+
+// SDSetting is a single setting of SDParameters
+type SDSetting struct {
+	Name  string
+	Value string
+}
+
+// Setting returns the value of the named setting, e.g. "Seed".
+func (p SDParameters) Setting(name string) (string, bool) {
+	for _, s := range p.Settings {
+		if s.Name == name {
+			return s.Value, true
+		}
+	}
+	return "", false
+}
+
+// SDParameters parses the generation parameters in the text chunk with the
+// keyword SDKeyword. ok is false for other chunks.
+func (c *Chunk) SDParameters() (SDParameters, bool) {
+	if !IsTextChunk(c.Type) || c.Keyword() != SDKeyword {
+		return SDParameters{}, false
+	}
+	text, err := c.Text()
+	if err != nil {
+		return SDParameters{}, false
+	}
+	return ParseSDParameters(text), true
+}
+
+// ParseSDParameters parses generation parameters in the AUTOMATIC1111 format.
+// The settings line is the last line starting with "Steps: "; if there is
+// none, the whole text is the prompt (and negative prompt).
+func ParseSDParameters(text string) SDParameters {
+	var p SDParameters
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "Steps: ") {
+			p.Settings = parseSDSettings(strings.Join(lines[i:], "\n"))
+			lines = lines[:i]
+			break
+		}
+	}
+	for i, line := range lines {
+		if neg, ok := strings.CutPrefix(line, "Negative prompt: "); ok {
+			rest := append([]string{neg}, lines[i+1:]...)
+			p.NegativePrompt = strings.TrimSpace(strings.Join(rest, "\n"))
+			lines = lines[:i]
+			break
+		}
+	}
+	p.Prompt = strings.TrimSpace(strings.Join(lines, "\n"))
+	return p
+}
+
+// parseSDSettings parses the "Name: value, Name: value" settings line. Values
+// containing commas are quoted, with backslash escapes.
+func parseSDSettings(line string) []SDSetting {
+	var settings []SDSetting
+	for line != "" {
+		name, rest, found := strings.Cut(line, ": ")
+		if !found {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var sb strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				sb.WriteByte(rest[i])
+			}
+			value = sb.String()
+			rest = rest[min(i+1, len(rest)):]
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		settings = append(settings, SDSetting{strings.TrimSpace(name), strings.TrimSpace(value)})
+		line = strings.TrimLeft(rest, " ")
+	}
+	return settings
+}
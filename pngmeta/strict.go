@@ -0,0 +1,108 @@
+// Strict validation against the PNG specification.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"fmt"
+	"strings"
+)
+
+// knownCritical are the critical chunk types defined by the specification.
+// A decoder must not display an image with any other critical chunk.
+var knownCritical = map[string]bool{
+	"IHDR": true,
+	"PLTE": true,
+	"IDAT": true,
+	"IEND": true,
+}
+
+// validate checks the chunks of a fully loaded PNG against the rules of the
+// specification that LoadOptions.Strict enforces: chunk checksums, the
+// presence and order of the critical chunks and the keywords of text chunks.
+// It returns the first violation found.
+func (png *PNG) validate() error {
+	var sawPLTE, sawIDAT, idatDone bool
+	for i, c := range png.Chunks {
+		if !c.ValidChecksum() {
+			return fmt.Errorf("%s at offset %d: CRC32 mismatch", c.Type, c.Offset)
+		}
+		// https://www.w3.org/TR/png/#5Chunk-naming-conventions
+		// Bit 5 of the first byte is 0 (uppercase) for critical chunks.
+		if len(c.Type) == 4 && c.Type[0]&0x20 == 0 && !knownCritical[c.Type] {
+			return fmt.Errorf("%s at offset %d: unknown critical chunk", c.Type, c.Offset)
+		}
+		if c.Type == "IDAT" {
+			if idatDone {
+				return fmt.Errorf("IDAT at offset %d: IDAT chunks are not consecutive", c.Offset)
+			}
+			sawIDAT = true
+		} else if sawIDAT {
+			idatDone = true
+		}
+		switch c.Type {
+		case "IHDR":
+			if i != 0 {
+				return fmt.Errorf("IHDR at offset %d: IHDR must be the first chunk", c.Offset)
+			}
+		case "PLTE":
+			if sawPLTE {
+				return fmt.Errorf("PLTE at offset %d: more than one PLTE chunk", c.Offset)
+			}
+			if sawIDAT {
+				return fmt.Errorf("PLTE at offset %d: PLTE must come before the IDAT chunks", c.Offset)
+			}
+			if png.ColorType == 0 || png.ColorType == 4 {
+				return fmt.Errorf("PLTE at offset %d: PLTE not allowed for color type %d", c.Offset, png.ColorType)
+			}
+			sawPLTE = true
+		case "IEND":
+			if i != len(png.Chunks)-1 {
+				return fmt.Errorf("IEND at offset %d: IEND must be the last chunk", c.Offset)
+			}
+		case "tEXt", "zTXt", "iTXt":
+			if err := ValidKeyword(c.Keyword()); err != nil {
+				return fmt.Errorf("%s at offset %d: %w", c.Type, c.Offset, err)
+			}
+		}
+	}
+	switch {
+	case png.Chunks[0].Type != "IHDR":
+		return fmt.Errorf("first chunk must be IHDR, got %s", png.Chunks[0].Type)
+	case !sawIDAT:
+		return fmt.Errorf("no IDAT chunk")
+	case png.ColorType == 3 && !sawPLTE:
+		return fmt.Errorf("no PLTE chunk in an indexed-color image")
+	}
+	return nil
+}
+
+// ValidKeyword checks a text chunk keyword against the rules of the
+// specification.
+//
+// From https://www.w3.org/TR/png/#11keywords
+// ```
+// Keywords shall contain only printable Latin-1 [ISO_8859-1] characters and
+// spaces; that is, only code points 0x20-7E and 0xA1-FF are allowed. To
+// reduce the chances for human misreading of a keyword, leading spaces,
+// trailing spaces, and consecutive spaces are not permitted in keywords, nor
+// is the non-breaking space (code point 0xA0) allowed.
+// ```
+// Keywords must also be 1-79 bytes long.
+func ValidKeyword(k string) error {
+	if len(k) < 1 || len(k) > 79 {
+		return fmt.Errorf("keyword must be 1-79 bytes long, got %d", len(k))
+	}
+	for i := 0; i < len(k); i++ {
+		if b := k[i]; b < 0x20 || (b > 0x7e && b < 0xa1) {
+			return fmt.Errorf("keyword %q contains invalid byte %#02x", k, b)
+		}
+	}
+	if strings.HasPrefix(k, " ") || strings.HasSuffix(k, " ") || strings.Contains(k, "  ") {
+		return fmt.Errorf("keyword %q has leading, trailing or consecutive spaces", k)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Generated images for benchmarking the parser.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// SyntheticImage is a generated PNG returned by SyntheticImages
+type SyntheticImage struct {
+	Name string
+	Data []byte
+}
+
+// SyntheticImages returns representative images for benchmarking the
+// parser: many small chunks, one huge IDAT chunk and many text chunks, all
+// 1024x1024 8 bit RGBA. pngrep's -benchmark and the Go benchmarks of this
+// package both parse them, so their numbers can be compared.
+func SyntheticImages() ([]SyntheticImage, error) {
+	ihdr := binary.BigEndian.AppendUint32(nil, 1024)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 1024)
+	// 8 bit RGBA, deflate, adaptive filtering, no interlacing
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	layouts := []struct {
+		name  string
+		chunk func(i int) *Chunk
+		n     int
+	}{
+		{"small-chunks", func(int) *Chunk {
+			return NewChunk("IDAT", make([]byte, 64))
+		}, 10000},
+		{"huge-idat", func(int) *Chunk {
+			return NewChunk("IDAT", make([]byte, 64<<20))
+		}, 1},
+		{"many-text", func(i int) *Chunk {
+			text := fmt.Appendf(nil, "Comment%d\x00%s", i, bytes.Repeat([]byte("lorem ipsum "), 20))
+			return NewChunk("tEXt", text)
+		}, 5000},
+	}
+	var images []SyntheticImage
+	for _, l := range layouts {
+		chunks := []*Chunk{NewChunk("IHDR", ihdr)}
+		for i := range l.n {
+			chunks = append(chunks, l.chunk(i))
+		}
+		if chunks[len(chunks)-1].Type != "IDAT" {
+			chunks = append(chunks, NewChunk("IDAT", make([]byte, 64)))
+		}
+		chunks = append(chunks, NewChunk("IEND", nil))
+		png, err := NewPNG(chunks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.name, err)
+		}
+		var buf bytes.Buffer
+		if _, err := png.WriteTo(&buf); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.name, err)
+		}
+		images = append(images, SyntheticImage{l.name, buf.Bytes()})
+	}
+	return images, nil
+}
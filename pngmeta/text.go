@@ -0,0 +1,150 @@
+// Text chunk (tEXt, zTXt and iTXt) decoding.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// CompressedText returns the still-compressed text of a zTXt chunk, or of an
+// iTXt chunk that has its compression flag set. For all other chunks, ok is
+// false.
+func (c *Chunk) CompressedText() (data []byte, ok bool) {
+	data, compressed, ok := c.textPayload()
+	if !ok || !compressed {
+		return nil, false
+	}
+	return data, true
+}
+
+// TextValue returns the value of a text chunk, i.e. the text after the
+// keyword, decompressed if necessary.
+func (c *Chunk) TextValue() ([]byte, error) {
+	data, compressed, ok := c.textPayload()
+	if !ok {
+		return nil, fmt.Errorf("%s chunk does not contain valid text", c.Type)
+	}
+	if compressed {
+		return inflate(data)
+	}
+	return data, nil
+}
+
+// Text returns the value of a text chunk as a string, like TextValue.
+func (c *Chunk) Text() (string, error) {
+	value, err := c.TextValue()
+	return string(value), err
+}
+
+// Language returns the language tag of an iTXt chunk, e.g. "en" or "de-CH".
+// It is empty for other chunks and if the tag is not given.
+func (c *Chunk) Language() string {
+	lang, _ := c.itxtNames()
+	return lang
+}
+
+// TranslatedKeyword returns the keyword of an iTXt chunk translated into its
+// language. It is UTF-8 encoded, and empty for other chunks and if no
+// translation is given.
+func (c *Chunk) TranslatedKeyword() string {
+	_, translated := c.itxtNames()
+	if !utf8.ValidString(translated) {
+		return ""
+	}
+	return translated
+}
+
+// itxtNames returns the language tag and translated keyword of an iTXt chunk
+func (c *Chunk) itxtNames() (lang, translated string) {
+	if c.Type != "iTXt" {
+		return "", ""
+	}
+	_, rest, found := bytes.Cut(c.Data, []byte{0})
+	if !found || len(rest) < 2 {
+		return "", ""
+	}
+	fields := bytes.SplitN(rest[2:], []byte{0}, 3)
+	if len(fields) < 3 {
+		return "", ""
+	}
+	return string(fields[0]), string(fields[1])
+}
+
+// TextStart returns the position of the value of a text chunk in its data,
+// after the keyword and, for iTXt, the language tag and translated keyword.
+// It is -1 for chunks without valid text.
+func (c *Chunk) TextStart() int {
+	data, _, ok := c.textPayload()
+	if !ok {
+		return -1
+	}
+	return len(c.Data) - len(data)
+}
+
+// textPayload returns the text part of a text chunk and whether it is
+// compressed. ok is false for other chunks and malformed text chunks.
+func (c *Chunk) textPayload() (data []byte, compressed bool, ok bool) {
+	_, rest, found := bytes.Cut(c.Data, []byte{0})
+	if !found {
+		return nil, false, false
+	}
+	switch c.Type {
+	case "tEXt":
+		// https://www.w3.org/TR/png/#11tEXt
+		// Keyword, NUL, text
+		return rest, false, true
+	case "zTXt":
+		// https://www.w3.org/TR/png/#11zTXt
+		// Keyword, NUL, compression method (1 byte), compressed text
+		if len(rest) < 1 {
+			return nil, false, false
+		}
+		return rest[1:], true, true
+	case "iTXt":
+		// https://www.w3.org/TR/png/#11iTXt
+		// Keyword, NUL, compression flag (1 byte), compression method (1
+		// byte), language tag, NUL, translated keyword, NUL, text
+		if len(rest) < 2 {
+			return nil, false, false
+		}
+		compressed = rest[0] == 1
+		_, rest, found = bytes.Cut(rest[2:], []byte{0})
+		if !found {
+			return nil, false, false
+		}
+		_, rest, found = bytes.Cut(rest, []byte{0})
+		if !found {
+			return nil, false, false
+		}
+		return rest, compressed, true
+	}
+	return nil, false, false
+}
+
+// DecompressText inflates the text of a zTXt chunk or a compressed iTXt chunk
+func (c *Chunk) DecompressText() ([]byte, error) {
+	data, ok := c.CompressedText()
+	if !ok {
+		return nil, fmt.Errorf("%s chunk does not contain compressed text", c.Type)
+	}
+	return inflate(data)
+}
+
+// inflate decompresses zlib data, which is the only compression method (0)
+// defined for PNG. On error, the data decompressed so far is returned.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
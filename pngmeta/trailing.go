@@ -0,0 +1,70 @@
+// Guessing the type of data appended after the IEND chunk.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// trailingSignatures are the starts of file types commonly appended to
+// images, to hide them or to smuggle them past filters.
+var trailingSignatures = []struct {
+	kind string
+	sig  string
+}{
+	{"ZIP", "PK\x03\x04"},
+	{"ZIP", "PK\x05\x06"},
+	{"RAR", "Rar!\x1a\x07"},
+	{"7z", "7z\xbc\xaf\x27\x1c"},
+	{"gzip", "\x1f\x8b"},
+	{"PNG", PNGMagic},
+	{"JPEG", "\xff\xd8\xff"},
+	{"PDF", "%PDF-"},
+	{"ELF", "\x7fELF"},
+	{"PE", "MZ"},
+	{"script", "#!"},
+}
+
+// scriptMarkers are found in scripts embedded in text, e.g. for XSS
+var scriptMarkers = []string{"<script", "<?php", "<%", "eval("}
+
+// TrailingType guesses the type of the data following the IEND chunk, by its
+// signature or, for text, its contents: one of ZIP, RAR, 7z, gzip, PNG,
+// JPEG, PDF, ELF, PE (Windows executables), script, text or unknown. It
+// returns an empty string if there is no trailing data.
+func (png PNG) TrailingType() string {
+	data := png.Trailing
+	if len(data) == 0 {
+		return ""
+	}
+	for _, s := range trailingSignatures {
+		if bytes.HasPrefix(data, []byte(s.sig)) {
+			return s.kind
+		}
+	}
+	lower := bytes.ToLower(data)
+	for _, m := range scriptMarkers {
+		if bytes.Contains(lower, []byte(m)) {
+			return "script"
+		}
+	}
+	// An archive may be preceded by padding, but its end record is always at
+	// the end.
+	if bytes.Contains(data, []byte("PK\x05\x06")) {
+		return "ZIP"
+	}
+	if utf8.Valid(data) && !bytes.ContainsFunc(data, isControl) {
+		return "text"
+	}
+	return "unknown"
+}
+
+// isControl reports whether r is a control character other than whitespace
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' && r != '\r'
+}
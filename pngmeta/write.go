@@ -0,0 +1,247 @@
+// Assembling and writing PNG images.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewChunk returns a chunk of the given type and data, with its length and
+// CRC32 checksum filled in
+func NewChunk(t string, data []byte) *Chunk {
+	c := &Chunk{Len: len(data), Type: t, Data: data}
+	c.UpdateChecksum()
+	return c
+}
+
+// UpdateChecksum sets the length and checksum of the chunk to match its data.
+// It must be called after modifying the type or data of a chunk.
+func (c *Chunk) UpdateChecksum() {
+	c.Len = len(c.Data)
+	c.Checksum = binary.BigEndian.AppendUint32(nil, c.ComputeChecksum())
+}
+
+// Clone returns a deep copy of the chunk. Chunks returned by Load own their
+// data, but chunks built by callers may share their Data with other buffers;
+// clone such chunks before modifying them in place, so the modification does
+// not leak into the original.
+func (c *Chunk) Clone() *Chunk {
+	return &Chunk{
+		Len:      c.Len,
+		Type:     c.Type,
+		Data:     bytes.Clone(c.Data),
+		Checksum: bytes.Clone(c.Checksum),
+		Offset:   c.Offset,
+
+		DataSkipped: c.DataSkipped,
+		crc:         c.crc,
+	}
+}
+
+// NewPNG assembles a PNG from the given chunks. The chunks must form a
+// coherent image: a valid IHDR chunk first, at least one IDAT chunk and an
+// IEND chunk last. Chunks without a checksum get their length and checksum
+// filled in.
+func NewPNG(chunks []*Chunk) (PNG, error) {
+	png := PNG{Chunks: chunks}
+	if len(chunks) == 0 {
+		return png, fmt.Errorf("no chunks given")
+	}
+	if chunks[0].Type != "IHDR" {
+		return png, fmt.Errorf("first chunk must be IHDR, got %s", chunks[0].Type)
+	}
+	idat := false
+	for i, c := range chunks {
+		if len(c.Type) != 4 {
+			return png, fmt.Errorf("chunk %d: invalid chunk type %q", i, c.Type)
+		}
+		if c.Checksum == nil {
+			c.UpdateChecksum()
+		}
+		if c.Len != len(c.Data) {
+			return png, fmt.Errorf("chunk %d (%s): length %d does not match data length %d",
+				i, c.Type, c.Len, len(c.Data))
+		}
+		switch c.Type {
+		case "IHDR":
+			if i != 0 {
+				return png, fmt.Errorf("chunk %d: IHDR must only appear as the first chunk", i)
+			}
+		case "IDAT":
+			idat = true
+		case "IEND":
+			if i != len(chunks)-1 {
+				return png, fmt.Errorf("chunk %d: IEND must be the last chunk", i)
+			}
+		}
+	}
+	if !idat {
+		return png, fmt.Errorf("no IDAT chunk given")
+	}
+	if chunks[len(chunks)-1].Type != "IEND" {
+		return png, fmt.Errorf("last chunk must be IEND, got %s", chunks[len(chunks)-1].Type)
+	}
+	if err := (&png).Fill(); err != nil {
+		return png, err
+	}
+	return png, nil
+}
+
+// StripTextChunks removes all tEXt, zTXt and iTXt chunks. It returns the
+// number of chunks removed and the number of bytes this saves in the file,
+// including the 12 bytes of length, type and checksum of every chunk.
+func (png *PNG) StripTextChunks() (int, int) {
+	return png.StripChunks(func(c *Chunk) bool { return IsTextChunk(c.Type) })
+}
+
+// StripChunks removes all chunks for which remove returns true. Like
+// StripTextChunks, it returns the number of chunks removed and the number of
+// bytes freed.
+func (png *PNG) StripChunks(remove func(*Chunk) bool) (int, int) {
+	var n, freed int
+	kept := png.Chunks[:0]
+	for _, c := range png.Chunks {
+		if remove(c) {
+			n++
+			freed += len(c.Data) + 12
+			continue
+		}
+		kept = append(kept, c)
+	}
+	png.Chunks = kept
+	png.NumCHunks = len(kept)
+	return n, freed
+}
+
+// NewTextChunk returns a text chunk with the given keyword and value. Values
+// made up of ASCII only are stored in a tEXt chunk, anything else in an
+// uncompressed iTXt chunk, which holds UTF-8.
+func NewTextChunk(keyword, value string) (*Chunk, error) {
+	if err := ValidKeyword(keyword); err != nil {
+		return nil, err
+	}
+	ascii := true
+	for i := 0; i < len(value); i++ {
+		if value[i] == 0 || value[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return NewChunk("tEXt", []byte(keyword+"\x00"+value)), nil
+	}
+	if !utf8.ValidString(value) || strings.IndexByte(value, 0) >= 0 {
+		return nil, fmt.Errorf("value for %q is not valid UTF-8 text", keyword)
+	}
+	// Keyword, NUL, compression flag, compression method, empty language
+	// tag, NUL, empty translated keyword, NUL, text
+	return NewChunk("iTXt", []byte(keyword+"\x00\x00\x00\x00\x00"+value)), nil
+}
+
+// SetTextValue replaces the value of a text chunk, keeping its type, keyword
+// and, for iTXt, language tag and translated keyword. Compressed values are
+// compressed again. The length and checksum are updated.
+func (c *Chunk) SetTextValue(value []byte) error {
+	_, compressed, ok := c.textPayload()
+	if !ok {
+		return fmt.Errorf("%s chunk does not contain valid text", c.Type)
+	}
+	if compressed {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(value)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		value = buf.Bytes()
+	}
+	start := c.TextStart()
+	data := make([]byte, 0, start+len(value))
+	data = append(data, c.Data[:start]...)
+	c.Data = append(data, value...)
+	c.UpdateChecksum()
+	return nil
+}
+
+// SetText sets the value of the text chunk with the given keyword. The first
+// text chunk with that keyword is replaced, and any further ones are removed.
+// If there is none, the new chunk is inserted before the first IDAT chunk. All
+// other chunks are left untouched.
+func (png *PNG) SetText(keyword, value string) error {
+	nc, err := NewTextChunk(keyword, value)
+	if err != nil {
+		return err
+	}
+	replaced := false
+	kept := png.Chunks[:0]
+	for _, c := range png.Chunks {
+		if IsTextChunk(c.Type) && c.Keyword() == keyword {
+			if !replaced {
+				kept = append(kept, nc)
+				replaced = true
+			}
+			continue
+		}
+		kept = append(kept, c)
+	}
+	png.Chunks = kept
+	if !replaced {
+		i := slices.IndexFunc(png.Chunks, func(c *Chunk) bool { return c.Type == "IDAT" })
+		if i < 0 {
+			return fmt.Errorf("no IDAT chunk to insert the text chunk before")
+		}
+		png.Chunks = slices.Insert(png.Chunks, i, nc)
+	}
+	png.NumCHunks = len(png.Chunks)
+	return nil
+}
+
+// WriteTo writes the PNG signature, all chunks and any trailing data to w.
+// Chunks are written as they are, including their stored checksums.
+func (png PNG) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, PNGMagic)
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	for _, c := range png.Chunks {
+		n, err := c.WriteTo(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	n, err = w.Write(png.Trailing)
+	total += int64(n)
+	return total, err
+}
+
+// WriteTo writes the chunk length, type, data and checksum to w. Chunks whose
+// data was skipped when loading cannot be written, and neither can truncated
+// ones, as that would lose the data that is there.
+func (c *Chunk) WriteTo(w io.Writer) (int64, error) {
+	if c.DataSkipped {
+		return 0, fmt.Errorf("%s chunk at offset %d: data was not loaded", c.Type, c.Offset)
+	}
+	if c.Truncated() {
+		return 0, fmt.Errorf("%s chunk at offset %d: chunk is truncated", c.Type, c.Offset)
+	}
+	buf := make([]byte, 0, 12+len(c.Data))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(c.Data)))
+	buf = append(buf, c.Type...)
+	buf = append(buf, c.Data...)
+	buf = append(buf, c.Checksum...)
+	n, err := w.Write(buf)
+	return int64(n), err
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package pngmeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	src := NewChunk("tEXt", []byte("Comment\x00hello"))
+	src.Offset = 33
+	data, checksum := bytes.Clone(src.Data), bytes.Clone(src.Checksum)
+
+	c := src.Clone()
+	if c.Offset != src.Offset {
+		t.Errorf("got offset %d, want %d", c.Offset, src.Offset)
+	}
+	c.Data[0] = 'X'
+	c.Checksum[0] ^= 0xff
+	c.UpdateChecksum()
+	if !bytes.Equal(src.Data, data) {
+		t.Errorf("source data changed to %q", src.Data)
+	}
+	if !bytes.Equal(src.Checksum, checksum) {
+		t.Errorf("source checksum changed to %x", src.Checksum)
+	}
+	if !src.ValidChecksum() {
+		t.Error("source checksum does not match its data anymore")
+	}
+}
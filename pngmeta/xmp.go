@@ -0,0 +1,157 @@
+// XMP (Extensible Metadata Platform) parsing.
+//
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+//
+
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XMPKeyword is the keyword of the text chunk holding the XMP packet, see
+// https://github.com/adobe/XMP-Toolkit-SDK/blob/main/docs/XMPSpecificationPart3.pdf
+const XMPKeyword = "XML:com.adobe.xmp"
+
+const rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// xmpPrefixes are the usual prefixes of common XMP namespaces, used if the
+// packet does not declare one.
+var xmpPrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":               "dc",
+	"http://ns.adobe.com/xap/1.0/":                   "xmp",
+	"http://ns.adobe.com/xap/1.0/rights/":            "xmpRights",
+	"http://ns.adobe.com/xap/1.0/mm/":                "xmpMM",
+	"http://ns.adobe.com/photoshop/1.0/":             "photoshop",
+	"http://ns.adobe.com/tiff/1.0/":                  "tiff",
+	"http://ns.adobe.com/exif/1.0/":                  "exif",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/":    "Iptc4xmpCore",
+	"http://iptc.org/std/Iptc4xmpExt/2008-02-29/":    "Iptc4xmpExt",
+	"http://www.w3.org/XML/1998/namespace":           "xml",
+	"http://ns.adobe.com/xap/1.0/sType/ResourceRef#": "stRef",
+}
+
+// XMPProperty is a property of an XMP packet with a simple value. Every item
+// of an array (rdf:Seq, rdf:Bag or rdf:Alt) is a property of its own, with
+// the name of the array. Fields of structures are named by the path to them,
+// e.g. Iptc4xmpCore:CreatorContactInfo/Iptc4xmpCore:CiEmailWork.
+type XMPProperty struct {
+	// Name is the qualified name of the property, e.g. dc:creator
+	Name  string
+	Value string
+}
+
+// IsXMP reports whether c is a text chunk holding an XMP packet
+func (c *Chunk) IsXMP() bool {
+	return IsTextChunk(c.Type) && c.Keyword() == XMPKeyword
+}
+
+// XMPProperties parses the XMP packet in a text chunk and returns its
+// properties in document order.
+func (c *Chunk) XMPProperties() ([]XMPProperty, error) {
+	if !c.IsXMP() {
+		return nil, fmt.Errorf("%s chunk does not contain XMP", c.Type)
+	}
+	packet, err := c.TextValue()
+	if err != nil {
+		return nil, err
+	}
+	return parseXMP(packet)
+}
+
+// parseXMP returns the properties in an XMP packet. Properties are the
+// children of rdf:Description elements, and the attributes of those elements
+// (the shorthand form). Whitespace around values is removed.
+func parseXMP(packet []byte) ([]XMPProperty, error) {
+	prefixes := make(map[string]string)
+	for ns, p := range xmpPrefixes {
+		prefixes[ns] = p
+	}
+	qname := func(n xml.Name) string {
+		if p, ok := prefixes[n.Space]; ok {
+			return p + ":" + n.Local
+		}
+		if n.Space == "" {
+			return n.Local
+		}
+		return n.Space + n.Local
+	}
+	var props []XMPProperty
+	// path holds the names of the property elements we are in. rdf elements
+	// are pushed as "" to keep the stack in sync with the document.
+	var path []string
+	inDescription := 0
+	property := func() string {
+		var names []string
+		for _, p := range path {
+			if p != "" {
+				names = append(names, p)
+			}
+		}
+		return strings.Join(names, "/")
+	}
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return props, nil
+		}
+		if err != nil {
+			return props, fmt.Errorf("invalid XMP: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					if _, ok := prefixes[a.Value]; !ok {
+						prefixes[a.Value] = a.Name.Local
+					}
+				}
+			}
+			name := ""
+			if t.Name.Space != rdfNS && inDescription > 0 {
+				name = qname(t.Name)
+			}
+			path = append(path, name)
+			if t.Name.Space == rdfNS && t.Name.Local == "Description" {
+				inDescription++
+			}
+			if inDescription == 0 {
+				continue
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns" || a.Name.Local == "xmlns":
+				case a.Name.Space == rdfNS && a.Name.Local == "resource":
+					props = append(props, XMPProperty{property(), a.Value})
+				case a.Name.Space == rdfNS || a.Name.Space == "http://www.w3.org/XML/1998/namespace":
+				default:
+					n := qname(a.Name)
+					if p := property(); p != "" {
+						n = p + "/" + n
+					}
+					props = append(props, XMPProperty{n, strings.TrimSpace(a.Value)})
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Space == rdfNS && t.Name.Local == "Description" {
+				inDescription--
+			}
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		case xml.CharData:
+			if inDescription == 0 {
+				continue
+			}
+			if v := strings.TrimSpace(string(t)); v != "" && property() != "" {
+				props = append(props, XMPProperty{property(), v})
+			}
+		}
+	}
+}
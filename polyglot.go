@@ -0,0 +1,98 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"iter"
+	"regexp"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// pdfHeaderWindow is how far into a file PDF readers look for the header
+const pdfHeaderWindow = 1024
+
+// polyglotContext is how many bytes after a marker are reported with it
+const polyglotContext = 32
+
+// htmlMarkers find HTML and script content that browsers or interpreters
+// would run, if a file is served or included as something else than an image.
+var htmlMarkers = regexp.MustCompile(`(?i)<(?:html|body|script|iframe|svg|object|embed)\b|<\?php|<%|javascript:|\bon(?:error|load)\s*=`)
+
+// zipMarkers are the signatures of the records of ZIP archives
+var zipMarkers = regexp.MustCompile(`PK\x03\x04|PK\x05\x06`)
+
+// polyglotAudit reports images that are also valid files of another type,
+// or carry content that is dangerous if they are taken for one: archives and
+// executables appended after IEND, ZIP records, PDF headers and HTML or
+// script markers in ancillary chunks or trailing data. It returns like
+// auditFiles.
+func polyglotAudit(files iter.Seq[string]) int {
+	return auditFiles(files, func(png pngmeta.PNG) []finding {
+		var findings []finding
+		for _, c := range png.Chunks {
+			// Bit 5 of the first byte is 1 (lowercase) for ancillary chunks.
+			if len(c.Type) != 4 || c.Type[0]&0x20 == 0 {
+				continue
+			}
+			data, where := c.Data, c.Type
+			if text, ok := searchableText(c); ok {
+				keyword, value, _ := strings.Cut(text, "\x00")
+				data, where = []byte(value), fmt.Sprintf("%s[%s]", c.Type, keyword)
+			}
+			findings = append(findings, markerFindings("html", where, data, htmlMarkers)...)
+			findings = append(findings, markerFindings("zip", where, data, zipMarkers)...)
+			// The data starts after the length and type.
+			if i := bytes.Index(c.Data, []byte("%PDF-")); i >= 0 && c.Offset+8+int64(i) < pdfHeaderWindow {
+				findings = append(findings, finding{"pdf", where, snippet(c.Data, i)})
+			}
+		}
+		if len(png.Trailing) > 0 {
+			findings = append(findings, trailingFindings(png.Trailing)...)
+		}
+		return findings
+	})
+}
+
+// trailingFindings reports what is dangerous about data after IEND
+func trailingFindings(data []byte) []finding {
+	var findings []finding
+	switch kind := (pngmeta.PNG{Trailing: data}).TrailingType(); kind {
+	case "ZIP":
+		// Archive readers look for the central directory from the end, so an
+		// appended archive is found as if the image were not there.
+		if zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+			findings = append(findings, finding{"zip", "trailing", fmt.Sprintf("valid ZIP archive with %d files", len(zr.File))})
+		} else {
+			findings = append(findings, markerFindings("zip", "trailing", data, zipMarkers)...)
+		}
+	case "RAR", "7z", "gzip":
+		findings = append(findings, finding{"archive", "trailing", kind + " archive"})
+	case "ELF", "PE":
+		findings = append(findings, finding{"executable", "trailing", kind + " executable"})
+	case "PDF":
+		findings = append(findings, finding{"pdf", "trailing", snippet(data, 0)})
+	default:
+		findings = append(findings, markerFindings("zip", "trailing", data, zipMarkers)...)
+	}
+	return append(findings, markerFindings("html", "trailing", data, htmlMarkers)...)
+}
+
+// markerFindings returns a finding for every match of rx in data
+func markerFindings(rule, where string, data []byte, rx *regexp.Regexp) []finding {
+	var findings []finding
+	for _, loc := range rx.FindAllIndex(data, -1) {
+		findings = append(findings, finding{rule, where, snippet(data, loc[0])})
+	}
+	return findings
+}
+
+// snippet returns the data at i, up to polyglotContext bytes
+func snippet(data []byte, i int) string {
+	return string(data[i:min(len(data), i+polyglotContext)])
+}
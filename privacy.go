@@ -0,0 +1,112 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// privacyRule is a kind of personally identifying metadata. It is found
+// either by the name of the field holding it, or by a pattern in any value.
+type privacyRule struct {
+	name   string
+	fields []string // field names, without XMP namespace prefix
+	rx     *regexp.Regexp
+}
+
+// privacyRules are the rules of -privacy-audit
+var privacyRules = []privacyRule{
+	{name: "gps", fields: []string{"GPSLatitude", "GPSLongitude"}},
+	{name: "serial-number", fields: []string{"BodySerialNumber", "LensSerialNumber", "SerialNumber", "InternalSerialNumber"}},
+	{name: "author", fields: []string{"Artist", "CameraOwnerName", "Author", "creator"}},
+	{name: "email", rx: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{name: "hostname", rx: regexp.MustCompile(`\b[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.(?:local|lan|internal|localdomain|intranet|corp|home\.arpa)\b`)},
+	{name: "user-path", rx: regexp.MustCompile(`(?:/home/|/Users/|[A-Za-z]:\\Users\\)[^/\\\s"]+`)},
+}
+
+// privacyAudit reports personally identifying metadata in the files: GPS
+// coordinates, serial numbers and authors in EXIF and XMP fields and text
+// chunks, and email addresses, hostnames and home directories in any of
+// them. It returns like auditFiles.
+func privacyAudit(files iter.Seq[string]) int {
+	return auditFiles(files, func(png pngmeta.PNG) []finding {
+		var findings []finding
+		for _, c := range png.Chunks {
+			for _, f := range metadataFields(c) {
+				local := f.name[strings.LastIndexAny(f.name, ":/")+1:]
+				where := fmt.Sprintf("%s[%s]", f.label, f.name)
+				for _, rule := range privacyRules {
+					if slices.Contains(rule.fields, local) {
+						findings = append(findings, finding{rule.name, where, f.value})
+						continue
+					}
+					if rule.rx == nil {
+						continue
+					}
+					for _, m := range rule.rx.FindAllString(f.value, -1) {
+						findings = append(findings, finding{rule.name, where, m})
+					}
+				}
+			}
+		}
+		return findings
+	})
+}
+
+// privacyRedactor returns the editFunc of -privacy-audit -redact. It redacts
+// what -privacy-audit finds in text chunks: the values of the text chunks
+// named like a field of a rule, and the matches of the other rules. EXIF and
+// XMP fields are not changed; use -strip-also eXIf for those.
+func privacyRedactor() editFunc {
+	var rxs []*regexp.Regexp
+	var keywords []string
+	for _, rule := range privacyRules {
+		if rule.rx != nil {
+			rxs = append(rxs, rule.rx)
+		}
+		keywords = append(keywords, rule.fields...)
+	}
+	return redactWith(combineRules(rxs), keywords)
+}
+
+// metadataField is a named value from a chunk
+type metadataField struct {
+	label string // the chunk type, or XMP
+	name  string
+	value string
+}
+
+// metadataFields returns the decoded fields of an eXIf chunk, the properties
+// of an XMP packet, or the keyword and value of any other text chunk.
+func metadataFields(c *pngmeta.Chunk) []metadataField {
+	var fields []metadataField
+	switch {
+	case c.Type == "eXIf":
+		exif, _ := c.ExifFields()
+		for _, f := range exif {
+			fields = append(fields, metadataField{c.Type, f.Name, f.Value})
+		}
+	case c.IsXMP():
+		props, err := c.XMPProperties()
+		if err == nil {
+			for _, p := range props {
+				fields = append(fields, metadataField{"XMP", p.Name, p.Value})
+			}
+			break
+		}
+		fallthrough
+	default:
+		if text, ok := searchableText(c); ok {
+			keyword, value, _ := strings.Cut(text, "\x00")
+			fields = append(fields, metadataField{c.Type, keyword, value})
+		}
+	}
+	return fields
+}
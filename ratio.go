@@ -0,0 +1,54 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// matchRatio is the fraction of text chunks of a file that matched
+type matchRatio struct {
+	filename string
+	matched  int
+	total    int
+}
+
+func (r matchRatio) value() float64 {
+	if r.total == 0 {
+		return 0
+	}
+	return float64(r.matched) / float64(r.total)
+}
+
+// ratios collects the match ratios of all files if they are to be sorted
+var ratios []matchRatio
+
+// printRatio prints how many of the text chunks of a file matched. With
+// -sort=ratio, the output is deferred until flushRatios is called.
+func printRatio(res result) {
+	r := matchRatio{res.label, len(res.chunks), res.textchunks}
+	if sortby == "ratio" {
+		ratios = append(ratios, r)
+		return
+	}
+	writeRatio(r)
+}
+
+// flushRatios prints the collected match ratios, highest first.
+func flushRatios() {
+	slices.SortStableFunc(ratios, func(a, b matchRatio) int {
+		return cmp.Compare(b.value(), a.value())
+	})
+	for _, r := range ratios {
+		writeRatio(r)
+	}
+	ratios = nil
+}
+
+func writeRatio(r matchRatio) {
+	printFields(colorName(displayName(r.filename)), fmt.Sprintf("%d/%d (%.0f%%)", r.matched, r.total, 100*r.value()))
+	endRecord()
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// editFunc returns the new value of a text chunk, and whether it changed
+type editFunc func(keyword string, value []byte) ([]byte, bool)
+
+// replaceWith returns an editFunc that replaces every match of rx with
+// template, which may refer to capture groups like regexp.Regexp.Expand does
+// ($1, ${name}).
+func replaceWith(rx *regexp.Regexp, template string) editFunc {
+	return func(_ string, value []byte) ([]byte, bool) {
+		if !rx.Match(value) {
+			return value, false
+		}
+		return rx.ReplaceAll(value, []byte(template)), true
+	}
+}
+
+// redactWith returns an editFunc for -redact: every match of rx, or with
+// -redact-whole the whole value, is replaced with the -redact-with
+// placeholder. The whole values of chunks with one of the keywords are
+// replaced, too. rx may be nil.
+func redactWith(rx *regexp.Regexp, keywords []string) editFunc {
+	return func(keyword string, value []byte) ([]byte, bool) {
+		matched := rx != nil && rx.Match(value)
+		switch {
+		case matched && !redactwhole:
+			return rx.ReplaceAllLiteral(value, []byte(redactwith)), true
+		case matched || slices.Contains(keywords, keyword):
+			return []byte(redactwith), string(value) != redactwith
+		}
+		return value, false
+	}
+}
+
+// replaceText edits the values of the text chunks of the files. Keywords are
+// left alone. Files in which anything changed are rewritten in place. With
+// -k, only the text chunks with that keyword are changed. It reports how many
+// chunks were changed in every file, using verb (e.g. "replaced text in"), and
+// returns the exit code like a search does: 0 if anything was changed, 1 if
+// not and 2 on errors.
+func replaceText(files iter.Seq[string], edit editFunc, verb string) int {
+	ret := 1
+	errs := 0
+	for filename := range files {
+		n, err := replaceInFile(filename, edit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errs++
+			if *halt {
+				break
+			}
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		ret = 0
+		fmt.Fprintf(out, "%s: %s %d chunks\n", displayName(filename), verb, n)
+		endRecord()
+	}
+	if errs > 0 {
+		ret = 2
+	}
+	return ret
+}
+
+// replaceInFile does the editing for one file and returns the number of
+// chunks changed.
+func replaceInFile(filename string, edit editFunc) (int, error) {
+	png, err := loadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, c := range png.Chunks {
+		if !pngmeta.IsTextChunk(c.Type) || (keyfilter != "" && c.Keyword() != keyfilter) {
+			continue
+		}
+		value, err := c.TextValue()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s at offset %d: %s", displayName(filename), c.Type, c.Offset, err)
+		}
+		value, changed := edit(c.Keyword(), value)
+		if !changed {
+			continue
+		}
+		if err := c.SetTextValue(value); err != nil {
+			return 0, fmt.Errorf("%s: %s at offset %d: %s", displayName(filename), c.Type, c.Offset, err)
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if err := rewriteFile(filename, png); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// combineRules returns a regexp matching any of rxs
+func combineRules(rxs []*regexp.Regexp) *regexp.Regexp {
+	var parts []string
+	for _, rx := range rxs {
+		parts = append(parts, "(?:"+rx.String()+")")
+	}
+	return regexp.MustCompile(strings.Join(parts, "|"))
+}
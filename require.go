@@ -0,0 +1,60 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// checkRequirements reports every file that lacks one of the required chunk
+// types or text keywords. It returns 0 if all files meet all requirements, 1
+// if at least one does not, and 2 on errors.
+func checkRequirements(files iter.Seq[string], chunkTypes, keywords []string) int {
+	ret := 0
+	for filename := range files {
+		missing, err := checkOneFile(filename, chunkTypes, keywords)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		for _, m := range missing {
+			printFields(colorName(displayName(filename)), "missing "+m)
+		}
+		endRecord()
+		if len(missing) > 0 && ret == 0 {
+			ret = 1
+		}
+	}
+	return ret
+}
+
+func checkOneFile(filename string, chunkTypes, keywords []string) ([]string, error) {
+	png, err := loadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, t := range chunkTypes {
+		if len(png.GetChunksByType(t)) == 0 {
+			missing = append(missing, "chunk "+t)
+		}
+	}
+	present := make(map[string]bool)
+	for _, c := range png.Chunks {
+		if pngmeta.IsTextChunk(c.Type) {
+			present[c.Keyword()] = true
+		}
+	}
+	for _, k := range keywords {
+		if !present[k] {
+			missing = append(missing, "keyword "+k)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// rewriteFile replaces the named file with the given PNG. The new contents
+// are written to a temporary file in the same directory first, which is then
+// renamed over the original, so a failure never leaves a half-written image
+// behind. The file mode of the original is preserved.
+func rewriteFile(filename string, png pngmeta.PNG) error {
+	return writeFileAs(filename, filename, png)
+}
+
+// writeFileAs writes the PNG read from filename to dst, safely like
+// rewriteFile, with the file mode of the original.
+func writeFileAs(filename, dst string, png pngmeta.PNG) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if isCompressed(filename) {
+		return fmt.Errorf("%s: rewriting compressed files is not supported", displayName(filename))
+	}
+	if err := checkComplete(filename, png); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".pngrep-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	if _, err := png.WriteTo(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// checkComplete returns an error if the PNG read from filename has a
+// truncated chunk: writing it back would lose the data that is there.
+// -repair drops such chunks.
+func checkComplete(filename string, png pngmeta.PNG) error {
+	for _, c := range png.Chunks {
+		if c.Truncated() {
+			return fmt.Errorf("%s: %s chunk at offset %d is truncated, not rewriting it (see -repair)",
+				displayName(filename), c.Type, c.Offset)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// truncatedPNG writes a PNG that is cut off within its IDAT chunk to a
+// temporary directory and returns its name and contents.
+func truncatedPNG(t *testing.T) (string, []byte) {
+	t.Helper()
+	ihdr := []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 2, 0, 0, 0}
+	png, err := pngmeta.NewPNG([]*pngmeta.Chunk{
+		pngmeta.NewChunk("IHDR", ihdr),
+		pngmeta.NewChunk("tEXt", []byte("Comment\x00hello")),
+		pngmeta.NewChunk("IDAT", bytes.Repeat([]byte{0x42}, 100)),
+		pngmeta.NewChunk("IEND", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := png.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// Signature, IHDR (25 bytes), tEXt (25 bytes) and half of the IDAT data
+	data := buf.Bytes()[:8+25+25+8+50]
+	filename := filepath.Join(t.TempDir(), "truncated.png")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename, data
+}
+
+func TestRewriteRefusesTruncated(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		rewrite func(filename string) int
+	}{
+		{"set", func(filename string) int { return setText(slices.Values([]string{filename}), []string{"Title=x"}) }},
+		{"strip", func(filename string) int { return stripFiles(slices.Values([]string{filename})) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filename, data := truncatedPNG(t)
+			if ret := tc.rewrite(filename); ret != 2 {
+				t.Errorf("got exit status %d, want 2", ret)
+			}
+			got, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("file was rewritten: got %d bytes, want the original %d", len(got), len(data))
+			}
+		})
+	}
+}
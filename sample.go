@@ -0,0 +1,45 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"iter"
+	"math/rand/v2"
+	"slices"
+)
+
+// sampleFiles picks n files uniformly at random from seq, in a single pass
+// (reservoir sampling), so the full list never has to be known up front. The
+// selected files are returned in the order they appeared in.
+func sampleFiles(seq iter.Seq[string], n int, rng *rand.Rand) []string {
+	type indexed struct {
+		idx  int
+		name string
+	}
+	var reservoir []indexed
+	i := 0
+	for name := range seq {
+		if len(reservoir) < n {
+			reservoir = append(reservoir, indexed{i, name})
+		} else if j := rng.IntN(i + 1); j < n {
+			reservoir[j] = indexed{i, name}
+		}
+		i++
+	}
+	slices.SortFunc(reservoir, func(a, b indexed) int { return a.idx - b.idx })
+	sample := make([]string, len(reservoir))
+	for k, r := range reservoir {
+		sample[k] = r.name
+	}
+	return sample
+}
+
+// newRand returns the random number generator for -sample. With a -seed, the
+// sample is reproducible.
+func newRand(seed uint64, seeded bool) *rand.Rand {
+	if !seeded {
+		seed = rand.Uint64()
+	}
+	return rand.New(rand.NewPCG(seed, seed))
+}
@@ -0,0 +1,329 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// chunkTypes is the parsed -chunk-type regexp, nil if there is none
+var chunkTypes *regexp.Regexp
+
+// rawChunk reports whether the raw data of a chunk is searched, because
+// -chunk-type selects it. Text chunks are always searched as text.
+func rawChunk(c *pngmeta.Chunk) bool {
+	if chunkTypes == nil || !chunkTypes.MatchString(c.Type) {
+		return false
+	}
+	switch c.Type {
+	case "tEXt", "zTXt", "iTXt":
+		return false
+	}
+	return true
+}
+
+// rawImageData reports whether -chunk-type selects the image data chunks,
+// which are then needed for searching.
+func rawImageData() bool {
+	return chunkTypes != nil && (chunkTypes.MatchString("IDAT") || chunkTypes.MatchString("fdAT"))
+}
+
+// textMatch is a text chunk that matched the regexp
+type textMatch struct {
+	chunk *pngmeta.Chunk
+	// The keyword, a NUL byte and the value, decompressed if necessary
+	text string
+	// For a field decoded from the chunk, like an EXIF field, what -byte-offset
+	// prints instead of the chunk type. Such matches have no offset in the
+	// file.
+	field string
+}
+
+// searchableText returns the keyword, a NUL byte and the (decompressed) value
+// of a text chunk. ok is false for chunks that are not searched and for
+// compressed chunks that cannot be decompressed. The value of an iTXt chunk
+// is UTF-8; invalid sequences are replaced by U+FFFD so they cannot derail
+// matching.
+func searchableText(c *pngmeta.Chunk) (string, bool) {
+	switch c.Type {
+	case "tEXt":
+		return string(c.Data), true
+	case "zTXt":
+		value, err := c.TextValue()
+		if err != nil {
+			return "", false
+		}
+		return c.Keyword() + "\x00" + string(value), true
+	case "iTXt":
+		value, err := c.TextValue()
+		if err != nil {
+			return "", false
+		}
+		return c.Keyword() + "\x00" + strings.ToValidUTF8(string(value), "\uFFFD"), true
+	}
+	return "", false
+}
+
+// grePNG returns the text chunks of png that rx matches, or with -v the ones
+// it does not match, and the number of text chunks searched. With -exif, the
+// fields of the eXIf chunk are searched like text chunks, too, and with
+// -stealth the metadata hidden in the pixels, as if it were in the first IDAT
+// chunk. With -l, it stops at the first match.
+func grePNG(png pngmeta.PNG, rx *regexp.Regexp) ([]textMatch, int) {
+	var matches []textMatch
+	n := 0
+	// search reports whether to stop searching.
+	search := func(c *pngmeta.Chunk, texts []string, field string) bool {
+		for _, text := range texts {
+			if keyfilter != "" {
+				if keyword, _, _ := strings.Cut(text, "\x00"); keyword != keyfilter {
+					continue
+				}
+			}
+			n++
+			if (len(findText(text, rx)) > 0) != *invert {
+				matches = append(matches, textMatch{c, text, field})
+				if *fileswith && !*invert {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, c := range png.Chunks {
+		texts, field := searchableTexts(c)
+		if search(c, texts, field) {
+			return matches, n
+		}
+	}
+	if idat := png.GetChunksByType("IDAT"); *stealth && len(idat) > 0 {
+		texts := stealthTexts(png)
+		if jsonPath != nil {
+			var selected []string
+			for _, text := range texts {
+				selected = append(selected, jsonPathTexts(text)...)
+			}
+			texts = selected
+		}
+		search(idat[0], texts, "stealth")
+	}
+	return matches, n
+}
+
+// searchableTexts returns what is searched in a chunk, in the form
+// searchableText returns: the text of a text chunk or, with -exif, every
+// field of an eXIf chunk as its name, a NUL byte and its value. The name of an
+// embedded ICC profile is searched with the keyword ICCProfile. With -xmp, the
+// properties of an XMP packet are returned the same way, instead of the packet,
+// with -sd the prompt, negative prompt and settings of Stable Diffusion
+// parameters, and with -comfy the nodes of a ComfyUI graph. With -jsonpath,
+// only the values it selects in text chunks holding JSON are returned, with
+// the keyword of the chunk; other text chunks are not searched. For such
+// decoded fields, it also returns what -byte-offset prints instead of the
+// chunk type. The raw data of chunks selected by -chunk-type is returned with
+// an empty keyword.
+func searchableTexts(c *pngmeta.Chunk) ([]string, string) {
+	if rawChunk(c) {
+		return []string{"\x00" + string(c.Data)}, ""
+	}
+	if *xmpsearch && c.IsXMP() {
+		props, _ := c.XMPProperties()
+		texts := make([]string, len(props))
+		for i, p := range props {
+			texts[i] = p.Name + "\x00" + p.Value
+		}
+		return texts, "XMP"
+	}
+	if c.Type == "eXIf" && *exifsearch {
+		fields, _ := c.ExifFields()
+		texts := make([]string, len(fields))
+		for i, f := range fields {
+			texts[i] = f.Name + "\x00" + f.Value
+		}
+		return texts, c.Type
+	}
+	if p, ok := c.SDParameters(); ok && *sdsearch {
+		texts := []string{"Prompt\x00" + p.Prompt, "Negative prompt\x00" + p.NegativePrompt}
+		for _, s := range p.Settings {
+			texts = append(texts, s.Name+"\x00"+s.Value)
+		}
+		return texts, c.Type
+	}
+	if *comfysearch && c.IsComfy() {
+		// Anything that is not a valid graph is searched as text.
+		if nodes, err := c.ComfyNodes(); err == nil {
+			var texts []string
+			for _, n := range nodes {
+				texts = append(texts, "class_type\x00"+n.ClassType)
+				for _, in := range n.Inputs {
+					texts = append(texts, n.ClassType+"."+in.Name+"\x00"+in.Value)
+				}
+			}
+			return texts, c.Type
+		}
+	}
+	if name, ok := c.ICCProfileName(); ok {
+		return []string{"ICCProfile\x00" + name}, c.Type
+	}
+	text, ok := searchableText(c)
+	if !ok {
+		return nil, ""
+	}
+	if jsonPath != nil {
+		return jsonPathTexts(text), c.Type
+	}
+	return []string{text}, ""
+}
+
+// jsonPathTexts returns the values -jsonpath selects in the value of a text,
+// each with the keyword of the text.
+func jsonPathTexts(text string) []string {
+	keyword, value, _ := strings.Cut(text, "\x00")
+	values, _ := jsonPathValues([]byte(value))
+	texts := make([]string, len(values))
+	for i, v := range values {
+		texts[i] = keyword + "\x00" + v
+	}
+	return texts
+}
+
+// findText returns the locations of all matches of rx in a text chunk. By
+// default, keyword and value are matched separately, so a match can not span
+// the NUL byte between them; -keyword and -value restrict matching to one of
+// them. With -raw-text, the chunk text is matched as a whole instead. Either
+// way, the locations are relative to the start of the
+// chunk text, or to the normalized chunk text with -normalize-space.
+func findText(text string, rx *regexp.Regexp) [][]int {
+	text = matchText(text)
+	if *rawtext {
+		return rx.FindAllStringIndex(text, -1)
+	}
+	keyword, value, _ := strings.Cut(text, "\x00")
+	var locs [][]int
+	if !*valueonly {
+		locs = rx.FindAllStringIndex(keyword, -1)
+	}
+	if *keyonly {
+		return locs
+	}
+	for _, loc := range rx.FindAllStringIndex(value, -1) {
+		locs = append(locs, []int{loc[0] + len(keyword) + 1, loc[1] + len(keyword) + 1})
+	}
+	return locs
+}
+
+// matchText returns the chunk text as it is matched against. With
+// -normalize-space, runs of whitespace in the keyword and value are collapsed
+// to a single space, and leading and trailing whitespace is removed.
+func matchText(text string) string {
+	if !*normspace {
+		return text
+	}
+	keyword, value, found := strings.Cut(text, "\x00")
+	text = strings.Join(strings.Fields(keyword), " ")
+	if found {
+		text += "\x00" + strings.Join(strings.Fields(value), " ")
+	}
+	return text
+}
+
+// matchedTypes returns the distinct chunk types of the matches, in order.
+func matchedTypes(matches []textMatch) []string {
+	var types []string
+	for _, m := range matches {
+		if !slices.Contains(types, m.chunk.Type) {
+			types = append(types, m.chunk.Type)
+		}
+	}
+	return types
+}
+
+// matchLocation is a match within a chunk, with its position, see
+// matchLocations
+type matchLocation struct {
+	where  string // as printed by -byte-offset, e.g. tEXt[1041]
+	offset int64  // the offset in the file, -1 if there is none
+	match  string
+}
+
+// matchLocations returns every match within a chunk along with its offset.
+// For uncompressed data, that is the offset in the file. Matches in the value
+// of a compressed chunk are located as TYPE[decompressed+N] instead, where N
+// is the offset in the decompressed value: it is a logical position that can
+// not be mapped to a position in the file. Matches in decoded fields, like
+// EXIF fields or XMP properties, are located as eXIf[Name] or XMP[name], with
+// the name of the field. In iTXt chunks, the language tag and translated
+// keyword between keyword and value are skipped, too. With -normalize-space,
+// all offsets refer to the normalized text.
+func matchLocations(m textMatch, rx *regexp.Regexp) []matchLocation {
+	_, compressed := m.chunk.CompressedText()
+	text := matchText(m.text)
+	keyword, _, _ := strings.Cut(text, "\x00")
+	klen := len(keyword)
+	var locs []matchLocation
+	for _, loc := range findText(m.text, rx) {
+		ml := matchLocation{offset: -1, match: text[loc[0]:loc[1]]}
+		if m.field != "" {
+			ml.where = fmt.Sprintf("%s[%s]", m.field, keyword)
+		} else if compressed && loc[0] > klen {
+			ml.where = fmt.Sprintf("%s[decompressed+%d]", m.chunk.Type, loc[0]-klen-1)
+		} else {
+			pos := loc[0]
+			if pos > klen {
+				// The raw data of other chunks has no keyword, see
+				// searchableTexts.
+				start := max(m.chunk.TextStart(), 0)
+				pos += start - klen - 1
+			}
+			// Skip the length and type fields of the chunk.
+			ml.offset = m.chunk.Offset + 8 + int64(pos)
+			ml.where = fmt.Sprintf("%s[%d]", m.chunk.Type, ml.offset)
+		}
+		locs = append(locs, ml)
+	}
+	return locs
+}
+
+// printOffsets prints every match within a chunk along with its location, as
+// returned by matchLocations.
+func printOffsets(filename string, m textMatch, rx *regexp.Regexp) {
+	for _, ml := range matchLocations(m, rx) {
+		printFields(filename, ml.where, quoteMatch(ml.match))
+	}
+}
+
+// printOnlyMatching prints every match within a chunk on a line of its own,
+// for -o. With -normalize-space, the matches are taken from the normalized
+// text.
+func printOnlyMatching(filename string, m textMatch, rx *regexp.Regexp) {
+	text := matchText(m.text)
+	for _, loc := range findText(m.text, rx) {
+		printFields(filename, quoteMatch(text[loc[0]:loc[1]]))
+	}
+}
+
+// sdSelected reports whether png has Stable Diffusion parameters with the
+// seed and model hash given with -sd-seed and -sd-model-hash. Model hashes are
+// compared ignoring case.
+func sdSelected(png pngmeta.PNG) bool {
+	for _, c := range png.Chunks {
+		p, ok := c.SDParameters()
+		if !ok {
+			continue
+		}
+		if seed, _ := p.Setting("Seed"); sdseed != "" && seed != sdseed {
+			return false
+		}
+		if hash, _ := p.Setting("Model hash"); sdmodelhash != "" && !strings.EqualFold(hash, sdmodelhash) {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"regexp"
+	"strings"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// secretRule is a named pattern for a kind of credential
+type secretRule struct {
+	name string
+	rx   *regexp.Regexp
+}
+
+// secretRules are the credential patterns -secrets looks for
+var secretRules = []secretRule{
+	{"aws-access-key-id", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-access-key", regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}?['"=: ]\s*[A-Za-z0-9/+]{40}\b`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{20,}=*`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"slack-webhook", regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/_]+`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"openai-api-key", regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{32,}`)},
+}
+
+// secretsRedactor returns the editFunc of -secrets -redact, which redacts
+// everything -secrets finds.
+func secretsRedactor() editFunc {
+	var rxs []*regexp.Regexp
+	for _, rule := range secretRules {
+		rxs = append(rxs, rule.rx)
+	}
+	return redactWith(combineRules(rxs), nil)
+}
+
+// finding is something an audit like -secrets found in a chunk
+type finding struct {
+	rule  string // the name of the rule
+	where string // the chunk type and the keyword or field, e.g. tEXt[Comment]
+	value string
+}
+
+// scanSecrets searches the text chunks of the files for credentials. It
+// returns like auditFiles.
+func scanSecrets(files iter.Seq[string]) int {
+	return auditFiles(files, func(png pngmeta.PNG) []finding {
+		var findings []finding
+		for _, c := range png.Chunks {
+			text, ok := searchableText(c)
+			if !ok {
+				continue
+			}
+			keyword, _, _ := strings.Cut(text, "\x00")
+			for _, rule := range secretRules {
+				for _, m := range rule.rx.FindAllString(text, -1) {
+					findings = append(findings, finding{rule.name, fmt.Sprintf("%s[%s]", c.Type, keyword), m})
+				}
+			}
+		}
+		return findings
+	})
+}
+
+// auditFiles runs an audit on every file and prints every finding as
+// filename, rule name, where it was found and the value. It returns 0 if
+// anything was found, 1 if not and 2 on errors, like a search does.
+func auditFiles(files iter.Seq[string], audit func(pngmeta.PNG) []finding) int {
+	ret := 1
+	errs := 0
+	for filename := range files {
+		png, err := loadFileWithOptions(filename, pngmeta.LoadOptions{SkipImageData: true})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errs++
+			if *halt {
+				break
+			}
+			continue
+		}
+		name := colorName(displayName(filename))
+		for _, f := range audit(png) {
+			printFields(name, f.rule, f.where, quoteMatch(f.value))
+			ret = 0
+		}
+		endRecord()
+	}
+	if errs > 0 {
+		ret = 2
+	}
+	return ret
+}
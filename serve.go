@@ -0,0 +1,185 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// serveResponse is the JSON response of the -serve API
+type serveResponse struct {
+	Matched bool         `json:"matched"`
+	Results []jsonResult `json:"results"`
+	Error   string       `json:"error,omitempty"`
+	// Errors are the members of an archive that could not be searched
+	Errors []string `json:"errors,omitempty"`
+}
+
+// serve answers search requests over HTTP on addr until it fails. The
+// options given on the command line apply to every search. The metrics are
+// served on /metrics.
+func serve(addr string) int {
+	if servemaxsize <= 0 {
+		fmt.Fprintln(os.Stderr, "-serve-max-size must be positive")
+		return 2
+	}
+	if metrics == nil {
+		metrics = newMetrics()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /search", handleSearch)
+	mux.Handle("GET /metrics", metrics)
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", addr)
+	err := http.ListenAndServe(addr, mux)
+	fmt.Fprintln(os.Stderr, err)
+	return 2
+}
+
+// handleSearch searches an image for the regexp in the pattern parameter.
+// The image is the request body, or the file or URL named by the path or url
+// parameter. Files have to be below -serve-root, URLs are only fetched with
+// -serve-urls. The response is a serveResponse, with the results as printed
+// by -json.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	rx, err := servePattern(q["pattern"])
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, serveResponse{Error: err.Error()})
+		return
+	}
+	var results []result
+	switch name := q.Get("path") + q.Get("url"); {
+	case q.Has("path") && q.Has("url"):
+		err = errors.New("only one of path and url can be given")
+	case q.Has("path"):
+		var path string
+		if path, err = servePath(name); err == nil {
+			results, err = grepFile(path, rx)
+		}
+		// Report the files as requested, not where the root is
+		for i := range results {
+			results[i].label = name + strings.TrimPrefix(results[i].label, path)
+		}
+	case q.Has("url"):
+		switch {
+		case !serveurls:
+			err = errors.New("fetching URLs is not enabled (see -serve-urls)")
+		case !isURL(name):
+			err = fmt.Errorf("%s: not an HTTP(S) URL", name)
+		default:
+			results, err = grepFile(name, rx)
+		}
+	default:
+		body := http.MaxBytesReader(w, r.Body, servemaxsize)
+		opts := searchOptions()
+		opts.MaxChunkSize = int(servemaxsize)
+		if maxchunk > 0 {
+			opts.MaxChunkSize = min(maxchunk, opts.MaxChunkSize)
+		}
+		png, lerr := loadReader("(request)", body, opts)
+		if bodyTooLarge(body) {
+			metrics.error()
+			writeResponse(w, http.StatusRequestEntityTooLarge, serveResponse{
+				Error: fmt.Sprintf("the image is larger than %d bytes", servemaxsize)})
+			return
+		}
+		if lerr == nil {
+			lerr = reportMismatches("(request)", png)
+		}
+		err = lerr
+		if err == nil {
+			results = []result{grepPNG(result{file: "(request)", label: "(request)"}, png, rx)}
+		}
+	}
+	if err != nil {
+		metrics.error()
+		writeResponse(w, http.StatusUnprocessableEntity, serveResponse{Error: err.Error()})
+		return
+	}
+	resp := serveResponse{Results: []jsonResult{}}
+	for _, res := range results {
+		if res.err != nil {
+			metrics.error()
+			resp.Errors = append(resp.Errors, res.err.Error())
+			continue
+		}
+		metrics.file(res.png)
+		if res.found() {
+			metrics.match()
+			resp.Matched = true
+			resp.Results = append(resp.Results, jsonRecord(res, rx))
+		}
+	}
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// bodyTooLarge reports whether reading a request body stopped at the
+// -serve-max-size limit. The loader does not pass on every read error, e.g.
+// not for a truncated file, but http.MaxBytesReader keeps failing once the
+// limit was hit.
+func bodyTooLarge(body io.Reader) bool {
+	var tooLarge *http.MaxBytesError
+	_, err := body.Read(make([]byte, 1))
+	return errors.As(err, &tooLarge)
+}
+
+// servePath resolves the path parameter of a request to a file below
+// -serve-root. The path is relative to the root and may not leave it, neither
+// with .. nor through symlinks.
+func servePath(name string) (string, error) {
+	if serveroot == "" {
+		return "", errors.New("searching files is not enabled (see -serve-root)")
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%s: not a path below the served directory", name)
+	}
+	root, err := filepath.EvalSymlinks(serveroot)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return "", fmt.Errorf("%s: no such file", name)
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s: not a path below the served directory", name)
+	}
+	return path, nil
+}
+
+// servePattern compiles the patterns of a request like the ones given on the
+// command line, honoring -F, -g and -i.
+func servePattern(pats []string) (*regexp.Regexp, error) {
+	if len(pats) == 0 {
+		return nil, errors.New("no pattern given")
+	}
+	re, err := combinePatterns(pats)
+	if err != nil {
+		return nil, err
+	}
+	if *caseins {
+		re = "(?i)" + re
+	}
+	rx, err := regexp.Compile(re)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp '%s': %s", re, err)
+	}
+	return rx, nil
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp serveResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing response failed: %s\n", err)
+	}
+}
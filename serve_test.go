@@ -0,0 +1,101 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+func TestServePath(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"root/a.png", "root/sub/b.png", "secret.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret.png"), filepath.Join(root, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+	saved := serveroot
+	t.Cleanup(func() { serveroot = saved })
+
+	serveroot = ""
+	if _, err := servePath("a.png"); err == nil {
+		t.Error("without -serve-root: got no error")
+	}
+	serveroot = root
+	for name, ok := range map[string]bool{
+		"a.png":                          true,
+		"sub/b.png":                      true,
+		"sub/../a.png":                   true,
+		"":                               false,
+		"../secret.png":                  false,
+		"sub/../../secret.png":           false,
+		filepath.Join(dir, "secret.png"): false,
+		"link.png":                       false,
+		"missing.png":                    false,
+	} {
+		path, err := servePath(name)
+		if ok && err != nil {
+			t.Errorf("%q: got error %s", name, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("%q: got %s, want an error", name, path)
+		}
+	}
+}
+
+func TestServeBodyLimit(t *testing.T) {
+	ihdr := []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 2, 0, 0, 0}
+	png, err := pngmeta.NewPNG([]*pngmeta.Chunk{
+		pngmeta.NewChunk("IHDR", ihdr),
+		pngmeta.NewChunk("tEXt", []byte("Comment\x00hello")),
+		pngmeta.NewChunk("IDAT", nil),
+		pngmeta.NewChunk("IEND", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := png.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	image := buf.Bytes()
+	saved := servemaxsize
+	t.Cleanup(func() { servemaxsize = saved })
+	servemaxsize = int64(len(image))
+
+	for _, tc := range []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"at the limit", image, http.StatusOK},
+		{"trailing data", append(bytes.Clone(image), make([]byte, 1000)...), http.StatusRequestEntityTooLarge},
+		// Cut off, but not by the limit
+		{"truncated", append(bytes.Clone(image[:len(image)-12]), 0, 1, 0, 0, 'I', 'D', 'A', 'T'), http.StatusOK},
+		// Too large for the limit, so the data is not even read
+		{"large chunk", append(bytes.Clone(image[:33]), 0, 1, 0, 0, 't', 'E', 'X', 't'), http.StatusUnprocessableEntity},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/search?pattern=hello", bytes.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			handleSearch(w, r)
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"strings"
+)
+
+// setText sets the text chunks given as keyword=value in the named files,
+// rewriting them in place. Existing text chunks with the same keyword are
+// replaced, all other chunks are kept as they are.
+func setText(files iter.Seq[string], assignments []string) int {
+	type kv struct{ key, value string }
+	var kvs []kv
+	for _, a := range assignments {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid -set '%s': must be keyword=value\n", a)
+			return 2
+		}
+		kvs = append(kvs, kv{key, value})
+	}
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		if err := checkComplete(filename, png); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		ok := true
+		for _, kv := range kvs {
+			if err := png.SetText(kv.key, kv.value); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", displayName(filename), err)
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			ret = 2
+			continue
+		}
+		if err := rewriteFile(filename, png); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		fmt.Fprintf(out, "%s: set %d text chunks\n", displayName(filename), len(kvs))
+		endRecord()
+	}
+	return ret
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"image"
+	"image/color"
+	"io"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// maxStealthPayload is the largest decompressed stealth payload read, so a
+// small compressed payload can not take all memory
+const maxStealthPayload = 16 << 20
+
+// stealthMagics are the headers of metadata hidden by NovelAI's "stealth"
+// scheme, and whether the payload is gzip-compressed. The pnginfo variants
+// use the alpha channel, the rgbinfo variants the color channels.
+var stealthMagics = map[string]bool{
+	"stealth_pnginfo": false,
+	"stealth_pngcomp": true,
+	"stealth_rgbinfo": false,
+	"stealth_rgbcomp": true,
+}
+
+// stealthTexts returns the metadata hidden in the pixels of the image by
+// NovelAI's stealth scheme, for -stealth: the least significant bits of the
+// alpha channel (or of the color channels), read column by column, hold a
+// magic string, the length of the payload in bits and the payload, which is
+// usually gzip-compressed JSON. Every member of a JSON object is returned
+// like a text chunk, as its name, a NUL byte and its value; any other payload
+// with the keyword stealth. An image without such metadata has none.
+func stealthTexts(p pngmeta.PNG) []string {
+	img, err := decodeImage(p)
+	if err != nil {
+		return nil
+	}
+	payload, ok := stealthPayload(img, []int{3})
+	if !ok {
+		payload, ok = stealthPayload(img, []int{0, 1, 2})
+	}
+	if !ok {
+		return nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		return []string{"stealth\x00" + string(payload)}
+	}
+	var texts []string
+	for _, k := range sortedKeys(obj) {
+		value, ok := obj[k].(string)
+		if !ok {
+			b, _ := json.Marshal(obj[k])
+			value = string(b)
+		}
+		texts = append(texts, k+"\x00"+value)
+	}
+	return texts
+}
+
+// stealthPayload reads the stealth metadata from the least significant bits
+// of the channels (0 to 3 for red, green, blue and alpha). Compressed
+// payloads larger than maxStealthPayload are ignored.
+func stealthPayload(img image.Image, channels []int) ([]byte, bool) {
+	br := &bitReader{img: img, channels: channels, x: img.Bounds().Min.X, y: img.Bounds().Min.Y}
+	magic, ok := br.bytes(len("stealth_pnginfo"))
+	if !ok {
+		return nil, false
+	}
+	compressed, found := stealthMagics[string(magic)]
+	if !found || (len(channels) == 1) != (string(magic[8:11]) == "png") {
+		return nil, false
+	}
+	head, ok := br.bytes(4)
+	if !ok {
+		return nil, false
+	}
+	bits := int(head[0])<<24 | int(head[1])<<16 | int(head[2])<<8 | int(head[3])
+	payload, ok := br.bytes(bits / 8)
+	if !ok {
+		return nil, false
+	}
+	if !compressed {
+		return payload, true
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, false
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, maxStealthPayload+1))
+	if err != nil || len(data) > maxStealthPayload {
+		return nil, false
+	}
+	return data, true
+}
+
+// bitReader reads the least significant bits of the channels of an image,
+// column by column, like the stealth scheme stores them.
+type bitReader struct {
+	img      image.Image
+	channels []int
+	x, y, ch int
+}
+
+// bytes reads n bytes, packed most significant bit first. It returns false if
+// the image does not have that many bits left.
+func (br *bitReader) bytes(n int) ([]byte, bool) {
+	b := br.img.Bounds()
+	if n < 0 || n > (b.Dx()*b.Dy()*len(br.channels))/8 {
+		return nil, false
+	}
+	data := make([]byte, n)
+	for i := range data {
+		for range 8 {
+			if br.x >= b.Max.X {
+				return nil, false
+			}
+			c := color.NRGBA64Model.Convert(br.img.At(br.x, br.y)).(color.NRGBA64)
+			values := [4]uint16{c.R, c.G, c.B, c.A}
+			data[i] = data[i]<<1 | byte(values[br.channels[br.ch]]&1)
+			if br.ch++; br.ch == len(br.channels) {
+				br.ch = 0
+				if br.y++; br.y == b.Max.Y {
+					br.y = b.Min.Y
+					br.x++
+				}
+			}
+		}
+	}
+	return data, true
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// stealthImage hides the payload in the least significant bits of the alpha
+// channel of a size×size image, with the stealth_pngcomp header, like
+// NovelAI does, and returns the image loaded with its image data.
+func stealthImage(t *testing.T, size int, payload []byte) pngmeta.PNG {
+	t.Helper()
+	var z bytes.Buffer
+	zw := gzip.NewWriter(&z)
+	zw.Write(payload)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("stealth_pngcomp")
+	data = binary.BigEndian.AppendUint32(data, uint32(z.Len()*8))
+	data = append(data, z.Bytes()...)
+	if len(data)*8 > size*size {
+		t.Fatalf("%d bytes do not fit in %dx%d pixels", len(data), size, size)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := range size * size {
+		// Column by column, most significant bit first
+		x, y := i/size, i%size
+		alpha := uint8(0xfe)
+		if i < len(data)*8 {
+			alpha |= data[i/8] >> (7 - i%8) & 1
+		}
+		img.SetNRGBA(x, y, color.NRGBA{0x10, 0x20, 0x30, alpha})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	p, err := pngmeta.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestStealthTexts(t *testing.T) {
+	p := stealthImage(t, 32, []byte(`{"Comment": "{\"seed\": 42}", "Software": "NovelAI", "steps": 28}`))
+	got := stealthTexts(p)
+	want := []string{"Comment\x00{\"seed\": 42}", "Software\x00NovelAI", "steps\x0028"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// A payload that decompresses to more than maxStealthPayload is ignored.
+func TestStealthTextsTooLarge(t *testing.T) {
+	p := stealthImage(t, 600, make([]byte, maxStealthPayload+1))
+	if got := stealthTexts(p); got != nil {
+		t.Errorf("got %d texts, want none", len(got))
+	}
+}
+
+// An image claiming more than maxDecodePixels is not decoded.
+func TestDecodeImageTooLarge(t *testing.T) {
+	ihdr := []byte{0, 0, 0xff, 0xff, 0, 0, 0xff, 0xff, 8, 6, 0, 0, 0}
+	p, err := pngmeta.NewPNG([]*pngmeta.Chunk{
+		pngmeta.NewChunk("IHDR", ihdr),
+		pngmeta.NewChunk("IDAT", []byte{0x78, 0x9c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01}),
+		pngmeta.NewChunk("IEND", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeImage(p); err == nil {
+		t.Error("got no error for a 65535x65535 image")
+	}
+}
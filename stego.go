@@ -0,0 +1,133 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// maxDecodePixels is the largest image, in pixels, that is decoded for
+// -scan-lsb, -stealth and -decode-check. Decoding allocates up to 8 bytes per
+// pixel, so a small file claiming to be huge could take all memory otherwise.
+const maxDecodePixels = 1 << 26
+
+// lsbMinRun is the length of the shortest run of printable bytes that
+// -scan-lsb considers to be text, like strings(1) does with -n
+const lsbMinRun = 8
+
+// lsbPlanes are the channel combinations whose least significant bits are
+// extracted, in the order they are taken from every pixel
+var lsbPlanes = []struct {
+	name     string
+	channels []int // 0 to 3 for red, green, blue and alpha
+}{
+	{"rgb", []int{0, 1, 2}},
+	{"rgba", []int{0, 1, 2, 3}},
+	{"r", []int{0}},
+	{"g", []int{1}},
+	{"b", []int{2}},
+	{"a", []int{3}},
+}
+
+// lsbMatch is a match in text hidden in the least significant bits of the
+// pixels
+type lsbMatch struct {
+	plane  string // the channels the bits were taken from, e.g. rgb
+	offset int    // the offset of the match in the extracted bytes
+	text   []byte
+}
+
+// scanLSB decodes the image and extracts the least significant bits of its
+// pixels, row by row, for every combination of channels in lsbPlanes. The
+// bits are packed into bytes, most significant bit first, and the regexp is
+// matched against every run of printable bytes. An image that cannot be
+// decoded has no matches.
+func scanLSB(p pngmeta.PNG, rx *regexp.Regexp) []lsbMatch {
+	img, err := decodeImage(p)
+	if err != nil {
+		return nil
+	}
+	var matches []lsbMatch
+	for _, plane := range lsbPlanes {
+		data := lsbBytes(img, plane.channels)
+		for _, run := range printableRuns(data) {
+			for _, loc := range rx.FindAllIndex(data[run[0]:run[1]], -1) {
+				start, end := run[0]+loc[0], run[0]+loc[1]
+				matches = append(matches, lsbMatch{plane.name, start, data[start:end]})
+			}
+		}
+	}
+	return matches
+}
+
+// decodeImage decodes the pixels of a PNG loaded with its image data. Images
+// larger than maxDecodePixels are refused.
+func decodeImage(p pngmeta.PNG) (image.Image, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return nil, fmt.Errorf("%dx%d pixels are too many to decode, the maximum is %d",
+			cfg.Width, cfg.Height, maxDecodePixels)
+	}
+	return png.Decode(&buf)
+}
+
+// lsbBytes returns the least significant bits of the channels of every
+// pixel, packed into bytes.
+func lsbBytes(img image.Image, channels []int) []byte {
+	b := img.Bounds()
+	data := make([]byte, 0, b.Dx()*b.Dy()*len(channels)/8+1)
+	var cur byte
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// 8 bit values are scaled to 16 bit by repeating them, so the
+			// least significant bit stays the same.
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			values := [4]uint16{c.R, c.G, c.B, c.A}
+			for _, ch := range channels {
+				cur = cur<<1 | byte(values[ch]&1)
+				n++
+				if n == 8 {
+					data = append(data, cur)
+					cur, n = 0, 0
+				}
+			}
+		}
+	}
+	return data
+}
+
+// printableRuns returns the start and end of every run of at least
+// lsbMinRun printable ASCII bytes in data.
+func printableRuns(data []byte) [][2]int {
+	var runs [][2]int
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && (data[i] >= 0x20 && data[i] < 0x7f || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= lsbMinRun {
+			runs = append(runs, [2]int{start, i})
+		}
+		start = -1
+	}
+	return runs
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// stripFiles removes all text chunks, and those of the types given with
+// -strip-also, from the named files. The files are rewritten in place, or with
+// -strip-to written to that directory under the same name. For every file,
+// and in total, it reports how many chunks were removed and how many bytes
+// that freed.
+func stripFiles(files iter.Seq[string]) int {
+	ret := 0
+	what := "text chunks"
+	if len(stripalso) > 0 {
+		what = "chunks"
+	}
+	remove := func(c *pngmeta.Chunk) bool {
+		return pngmeta.IsTextChunk(c.Type) || slices.Contains(stripalso, c.Type)
+	}
+	var totalChunks, totalBytes int
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		if err := checkComplete(filename, png); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		n, freed := png.StripChunks(remove)
+		if stripto != "" {
+			dst := filepath.Join(stripto, filepath.Base(filename))
+			if err := writeFileAs(filename, dst, png); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = 2
+				continue
+			}
+		} else if n > 0 {
+			if err := rewriteFile(filename, png); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = 2
+				continue
+			}
+		}
+		totalChunks += n
+		totalBytes += freed
+		fmt.Fprintf(out, "%s: stripped %d %s, freed %d bytes\n",
+			displayName(filename), n, what, freed)
+		endRecord()
+	}
+	fmt.Fprintf(out, "total: stripped %d %s, freed %d bytes\n",
+		totalChunks, what, totalBytes)
+	return ret
+}
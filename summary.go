@@ -0,0 +1,60 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// numSlowest is the number of slowest files listed with -summary -timing
+const numSlowest = 5
+
+// stats are the totals of one run.
+type stats struct {
+	Files   int `json:"files"`
+	Matches int `json:"matches"`
+	Errors  int `json:"errors"`
+	Sampled int `json:"sampled,omitempty"`
+
+	slowest []fileTime
+}
+
+// fileTime is the time it took to parse and search one file
+type fileTime struct {
+	filename string
+	elapsed  time.Duration
+}
+
+// addTime records the time spent on a file, keeping only the slowest ones.
+func (st *stats) addTime(filename string, elapsed time.Duration) {
+	st.slowest = append(st.slowest, fileTime{filename, elapsed})
+	slices.SortFunc(st.slowest, func(a, b fileTime) int {
+		return cmp.Compare(b.elapsed, a.elapsed)
+	})
+	if len(st.slowest) > numSlowest {
+		st.slowest = st.slowest[:numSlowest]
+	}
+}
+
+func (st stats) print(w io.Writer) {
+	fmt.Fprintf(w, "files: %d, matches: %d, errors: %d\n", st.Files, st.Matches, st.Errors)
+	if st.Sampled > 0 {
+		fmt.Fprintf(w, "sampled: %d\n", st.Sampled)
+	}
+	if len(st.slowest) > 0 {
+		fmt.Fprintln(w, "slowest files:")
+		for _, ft := range st.slowest {
+			fmt.Fprintf(w, "  %s: %s\n", displayName(ft.filename), formatDuration(ft.elapsed))
+		}
+	}
+}
+
+// formatDuration prints d in milliseconds with one decimal, e.g. "12.3ms".
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,38 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+)
+
+// checkTextCompression tries to decompress every compressed text chunk and
+// reports those that fail. It returns 0 if all chunks decompress fine, 1 if at
+// least one does not, and 2 on errors.
+func checkTextCompression(files iter.Seq[string]) int {
+	ret := 0
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 2
+			continue
+		}
+		for _, c := range png.Chunks {
+			if _, ok := c.CompressedText(); !ok {
+				continue
+			}
+			if _, err := c.DecompressText(); err != nil {
+				printFields(colorName(displayName(filename)), c.Type, c.Keyword(), err)
+				endRecord()
+				if ret == 0 {
+					ret = 1
+				}
+			}
+		}
+	}
+	return ret
+}
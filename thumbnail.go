@@ -0,0 +1,43 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"fmt"
+	"iter"
+	"os"
+)
+
+// extractThumbnails writes the EXIF thumbnail of every file to
+// <filename>.thumb.jpg (see outputName). It returns 0 if at least one thumbnail was extracted,
+// 1 if none were found, and 2 on errors.
+func extractThumbnails(files iter.Seq[string]) int {
+	ret := 1
+	errors := false
+	for filename := range files {
+		png, err := loadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errors = true
+			continue
+		}
+		thumb, ok := png.ExifThumbnail()
+		if !ok {
+			continue
+		}
+		outname := outputName(filename, ".thumb.jpg")
+		if err := os.WriteFile(outname, thumb, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errors = true
+			continue
+		}
+		printFields(colorName(displayName(filename)), fmt.Sprintf("wrote %s (%d bytes)", displayName(outname), len(thumb)))
+		endRecord()
+		ret = 0
+	}
+	if errors {
+		return 2
+	}
+	return ret
+}
@@ -0,0 +1,273 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// inputFiles returns the files to search: the arguments and, with
+// -files-from, the files listed there, with directories walked by walkFiles.
+// Problems are reported to stderr and counted in errs.
+func inputFiles(args []string, errs *int) iter.Seq[string] {
+	names := slices.Values(args)
+	if filesfrom != "" {
+		names = concat(names, readFileList(filesfrom, errs))
+	}
+	return walkFiles(names, errs)
+}
+
+// walkFiles returns the files to search. Arguments that are not directories
+// are returned as they are. With -r, directories are walked recursively and
+// all PNG files below them are returned, skipping hidden files and
+// directories as well as anything excluded by -include, -exclude and
+// -exclude-dir. Files named explicitly are always searched, no matter their
+// name. Problems reading a directory are reported to stderr and counted in
+// errs.
+func walkFiles(args iter.Seq[string], errs *int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for arg := range args {
+			if !*recursive {
+				if !yield(arg) {
+					return
+				}
+				continue
+			}
+			fi, err := os.Stat(arg)
+			if err != nil || !fi.IsDir() {
+				// Let the caller report the problem, if any.
+				if !yield(arg) {
+					return
+				}
+				continue
+			}
+			root := ""
+			if pathmode == "relative" {
+				root, _ = filepath.Abs(arg)
+			}
+			stop := false
+			filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					(*errs)++
+					return nil
+				}
+				if path == arg {
+					return nil
+				}
+				if d.IsDir() {
+					if strings.HasPrefix(d.Name(), ".") || matchAny(excludedirs, d.Name()) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !wantFile(path, d.Name()) {
+					return nil
+				}
+				if root != "" {
+					addWalkRoot(path, root)
+				}
+				if !yield(path) {
+					stop = true
+					return filepath.SkipAll
+				}
+				return nil
+			})
+			if stop {
+				return
+			}
+		}
+	}
+}
+
+// walkRoots maps the files found while walking a directory with -r to that
+// directory, as an absolute path, for -path=relative. Files are added while
+// walking, which happens concurrently to printing the results.
+var walkRoots struct {
+	sync.Mutex
+	dirs map[string]string
+}
+
+// addWalkRoot records that path was found while walking the directory root.
+func addWalkRoot(path, root string) {
+	walkRoots.Lock()
+	defer walkRoots.Unlock()
+	if walkRoots.dirs == nil {
+		walkRoots.dirs = make(map[string]string)
+	}
+	// With nested directories, a file is found twice; stick to the first.
+	if _, ok := walkRoots.dirs[path]; !ok {
+		walkRoots.dirs[path] = root
+	}
+}
+
+// walkRoot returns the directory the file was found in while walking with -r,
+// or "" if it was named explicitly. For a label like archive.zip!member.png,
+// file.png#2 or dump.bin@1234, it is the directory of the file.
+func walkRoot(label string) string {
+	walkRoots.Lock()
+	defer walkRoots.Unlock()
+	if root, ok := walkRoots.dirs[label]; ok {
+		return root
+	}
+	for i := len(label) - 1; i > 0; i-- {
+		switch label[i] {
+		case '!', '#', '@':
+			if root, ok := walkRoots.dirs[label[:i]]; ok {
+				return root
+			}
+		}
+	}
+	return ""
+}
+
+// concat returns the values of all seqs, one after the other
+func concat(seqs ...iter.Seq[string]) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, seq := range seqs {
+			for v := range seq {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readFileList returns the filenames listed in the named file (or standard
+// input for "-"), for -files-from. They are separated by newlines, or with
+// -0 by NUL bytes. The list is read as the names are consumed, so it can be
+// arbitrarily long. A problem reading the list is reported to stderr and
+// counted in errs.
+func readFileList(filename string, errs *int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		f, err := openFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			(*errs)++
+			return
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 1<<20)
+		if nulsep {
+			sc.Split(splitNUL)
+		}
+		for sc.Scan() {
+			name := sc.Text()
+			if !nulsep {
+				name = strings.TrimSuffix(name, "\r")
+			}
+			if name == "" {
+				continue
+			}
+			if !yield(name) {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "Reading %s failed: %s\n", filename, err)
+			(*errs)++
+		}
+	}
+}
+
+// splitNUL is a bufio.SplitFunc for NUL-terminated names
+func splitNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// wantFile reports whether a file found while walking a directory is searched.
+// By default, that is every non-hidden PNG file, as told by its signature or,
+// with -detect=extension, its name. With -include, it is every file matching
+// one of the patterns. OpenRaster and Krita documents are searched, too, and
+// with -archive zip and tar archives.
+// Files matching an -exclude pattern are never searched.
+func wantFile(path, name string) bool {
+	if strings.HasPrefix(name, ".") || matchAny(excludes, name) {
+		return false
+	}
+	if len(includes) > 0 {
+		return matchAny(includes, name)
+	}
+	if isContainer(name) || (*archives && isArchive(name)) {
+		return true
+	}
+	if detect == "extension" {
+		return isPNGName(name)
+	}
+	return hasPNGSignature(path)
+}
+
+// hasPNGSignature reports whether the file starts with the PNG signature,
+// after decompressing it if it is compressed. Files that cannot be read are
+// reported as PNGs, so the problem shows up when searching them.
+func hasPNGSignature(path string) bool {
+	open := func(path string) (io.ReadCloser, error) { return os.Open(path) }
+	if isCompressed(path) {
+		open = openImage
+	}
+	f, err := open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	sig := make([]byte, len(pngmeta.PNGMagic))
+	if _, err := io.ReadFull(f, sig); err != nil {
+		return err != io.EOF && err != io.ErrUnexpectedEOF
+	}
+	return string(sig) == pngmeta.PNGMagic
+}
+
+// checkDetect validates the value of the -detect flag.
+func checkDetect(mode string) error {
+	switch mode {
+	case "signature", "extension":
+		return nil
+	}
+	return fmt.Errorf("invalid -detect '%s': must be signature or extension", mode)
+}
+
+// matchAny reports whether name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGlobs returns an error for the first malformed glob pattern.
+func checkGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %s", p, err)
+		}
+	}
+	return nil
+}
+
+// isPNGName reports whether the filename has a .png extension, in any case.
+func isPNGName(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".png")
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"pkg.i-no.de/pkg/pngrep/pngmeta"
+)
+
+// Filters only apply to the files found while walking directories, files
+// named explicitly are always searched.
+func TestWalkExplicitFilesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "thumb.png", ".hidden.png", "sub/b.png", "cache/c.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(pngmeta.PNGMagic), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec, det, exc, excdirs := *recursive, detect, excludes, excludedirs
+	t.Cleanup(func() {
+		*recursive, detect, excludes, excludedirs = rec, det, exc, excdirs
+	})
+	*recursive, detect = true, "signature"
+	excludes, excludedirs = stringList{"thumb*"}, stringList{"cache"}
+
+	args := []string{
+		dir,
+		filepath.Join(dir, "thumb.png"),
+		filepath.Join(dir, ".hidden.png"),
+		filepath.Join(dir, "cache/c.png"),
+	}
+	errs := 0
+	got := slices.Collect(walkFiles(slices.Values(args), &errs))
+	want := []string{
+		filepath.Join(dir, "a.png"),
+		filepath.Join(dir, "sub/b.png"),
+		filepath.Join(dir, "thumb.png"),
+		filepath.Join(dir, ".hidden.png"),
+		filepath.Join(dir, "cache/c.png"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+	if errs != 0 {
+		t.Errorf("got %d errors, want none", errs)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"iter"
+	"os"
+	"time"
+)
+
+// fileState is what -watch remembers about a file to tell whether it changed
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchFiles returns the files to search with -watch: every interval, the
+// arguments are walked like with -r, and the files that were created or
+// modified since the last walk are returned. The files present at the start
+// are not. A file is only returned once its size and modification time have
+// not changed for one interval, so files still being written are not searched
+// half-finished. The sequence only ends when the consumer stops, or stop is
+// closed, which also ends waiting for the next walk.
+func watchFiles(args []string, interval time.Duration, errs *int, stop <-chan struct{}) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		seen := scanFiles(args, errs)
+		pending := map[string]fileState{}
+		for {
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+			now := scanFiles(args, errs)
+			for name, fs := range now {
+				if old, ok := seen[name]; ok && old == fs {
+					delete(pending, name)
+					continue
+				}
+				if p, ok := pending[name]; !ok || p != fs {
+					// New or still changing, look again next time.
+					pending[name] = fs
+					continue
+				}
+				delete(pending, name)
+				seen[name] = fs
+				if !yield(name) {
+					return
+				}
+			}
+			for name := range seen {
+				if _, ok := now[name]; !ok {
+					delete(seen, name)
+				}
+			}
+			for name := range pending {
+				if _, ok := now[name]; !ok {
+					delete(pending, name)
+				}
+			}
+		}
+	}
+}
+
+// scanFiles returns the size and modification time of all files walkFiles
+// finds for args.
+func scanFiles(args []string, errs *int) map[string]fileState {
+	files := map[string]fileState{}
+	for name := range inputFiles(args, errs) {
+		fi, err := os.Stat(name)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		files[name] = fileState{fi.Size(), fi.ModTime()}
+	}
+	return files
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Tobias Klausmann
+// Licensed under the GPLv3, see COPYING for details
+
+package main
+
+import (
+	"iter"
+	"sync"
+	"time"
+)
+
+// job is one file searched by a worker
+type job struct {
+	filename string
+	results  []result
+	err      error
+	elapsed  time.Duration
+	done     chan struct{}
+}
+
+// searchFiles searches the files with n concurrent workers. The jobs are
+// returned in the order of files, each one as soon as it and all the ones
+// before it are done, so the output is the same as for a sequential search.
+// At most n files are searched ahead of the one being returned.
+func searchFiles(files iter.Seq[string], n int, search func(string) ([]result, error)) iter.Seq[*job] {
+	return func(yield func(*job) bool) {
+		todo := make(chan *job)
+		pending := make(chan *job, n)
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range todo {
+					start := time.Now()
+					j.results, j.err = search(j.filename)
+					j.elapsed = time.Since(start)
+					close(j.done)
+				}
+			}()
+		}
+		go func() {
+			defer close(pending)
+			defer close(todo)
+			for filename := range files {
+				j := &job{filename: filename, done: make(chan struct{})}
+				select {
+				case pending <- j:
+				case <-stop:
+					return
+				}
+				todo <- j
+			}
+		}()
+		defer func() {
+			// Let the workers finish what they started.
+			close(stop)
+			for range pending {
+			}
+			wg.Wait()
+		}()
+		for j := range pending {
+			<-j.done
+			if !yield(j) {
+				return
+			}
+		}
+	}
+}